@@ -17,60 +17,380 @@ limitations under the License.
 package v1alpha1
 
 import (
-	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// RedisMode is the topology the Redis pods are deployed in
+// +kubebuilder:validation:Enum=replication;cluster
+type RedisMode string
+
+const (
+	// RedisModeReplication runs a single primary with Replicas-1 replicas
+	RedisModeReplication RedisMode = "replication"
+	// RedisModeCluster runs a Redis Cluster sharding the keyspace across Shards primaries
+	RedisModeCluster RedisMode = "cluster"
+)
+
 // RedisSpec defines the desired state of Redis
+// +kubebuilder:validation:XValidation:rule=`!has(self.sentinel) || !has(self.mode) || self.mode != 'cluster'`,message="sentinel only applies to replication mode"
+// +kubebuilder:validation:XValidation:rule=`(has(self.mode) && self.mode == 'cluster') || !has(self.replicas) || self.replicas >= 1`,message="replication mode needs at least 1 replica"
+// +kubebuilder:validation:XValidation:rule=`!has(self.mode) || self.mode != 'cluster' || (has(self.shards) && self.shards >= 3)`,message="cluster mode needs at least 3 shards"
+// +kubebuilder:validation:XValidation:rule=`!has(oldSelf.mode) || !has(self.mode) || self.mode == oldSelf.mode`,message="mode is immutable"
 type RedisSpec struct {
 
-	// Image is the Redis Docker image
-	Image string `json:"image"`
+	// Image is the Redis Docker image without a tag, redis by default
+	Image string `json:"image,omitempty"`
+
+	// Version is the version of Redis to deploy, used as the image tag. It defaults to a pinned
+	// version supported by the operator.
+	Version string `json:"version,omitempty"`
 
-	// Version is the version of Redis to deploy
-	Version string `json:"version"`
+	// Storage defines the storage requirements for Redis. The size defaults to 1Gi unless persistence is disabled.
+	Storage RedisStorage `json:"storage,omitempty"`
 
-	// Storage defines the storage requirements for Redis
-	Storage RedisStorage `json:"storage"`
+	// Persistence selects how Redis persists its data. It defaults to RDB snapshots on a volume
+	// claimed from Storage.
+	Persistence *RedisPersistence `json:"persistence,omitempty"`
 
-	// Replicas is the number of replicas for each Redis node
+	// RestoreFrom seeds the data volume with an RDB file or a VolumeSnapshot before Redis first starts.
+	// It only applies when the instance is created.
+	RestoreFrom *RedisRestoreSource `json:"restoreFrom,omitempty"`
+
+	// Mode is the topology of the Redis pods, either replication or cluster
+	// +kubebuilder:default=replication
+	Mode RedisMode `json:"mode,omitempty"`
+
+	// Replicas is the number of Redis pods in replication mode. The first pod is the
+	// replication primary and every other pod replicates from it.
+	// +kubebuilder:default=1
+	// +optional
 	Replicas int32 `json:"replicas"`
 
-	// SecretName is the name of the Kubernetes Secret object that stores the Redis password
+	// Shards is the number of primaries the hash slots are spread across in cluster mode, 3 by
+	// default. Changing it migrates hash slots online to or from the added or removed shards.
+	// +kubebuilder:validation:Minimum=1
+	Shards int32 `json:"shards,omitempty"`
+
+	// ReplicasPerShard is the number of replicas of each shard primary in cluster mode
+	// +kubebuilder:validation:Minimum=0
+	ReplicasPerShard int32 `json:"replicasPerShard,omitempty"`
+
+	// SecretName is the name of an existing Kubernetes Secret object that stores the Redis password.
+	// The Secret is neither owned nor deleted by the operator. When empty, the operator generates
+	// a password and stores it in the Secret "<name>-secret".
 	SecretName string `json:"secretName,omitempty"`
 
-	// Resources defines the CPU and memory resource requirements
-	Resources RedisResources `json:"resources"`
+	// SecretKey is the key of the Redis password in the Secret
+	// +kubebuilder:default=password
+	SecretKey string `json:"secretKey,omitempty"`
+
+	// PasswordPolicy controls how the operator generates the password when SecretName is not set
+	PasswordPolicy *RedisPasswordPolicy `json:"passwordPolicy,omitempty"`
+
+	// PasswordRotation rotates the generated password periodically. A rotation can also be
+	// requested at any time by setting the cache.tc/rotate-password annotation to a new value.
+	// User-supplied Secrets are never rotated by the operator.
+	PasswordRotation *RedisPasswordRotation `json:"passwordRotation,omitempty"`
+
+	// Resources defines the CPU and memory resource requirements. Unset requests and the memory
+	// limit are defaulted.
+	Resources RedisResources `json:"resources,omitempty"`
+
+	// Config holds redis.conf directives, such as maxmemory-policy or save, keyed by directive name.
+	// Directives managed by the operator, such as port or requirepass, cannot be set.
+	Config map[string]string `json:"config,omitempty"`
+
+	// Service configures the client Service routing to the primary, or to every node in cluster mode.
+	// It defaults to a ClusterIP Service on port 6379.
+	Service *RedisService `json:"service,omitempty"`
+
+	// Sentinel deploys a Redis Sentinel quorum that monitors the primary and promotes
+	// a replica when it fails. Sentinel is disabled when unset and only applies to replication mode.
+	Sentinel *RedisSentinel `json:"sentinel,omitempty"`
+
+	// TLS encrypts client, replication, cluster bus and Sentinel traffic. TLS is disabled when unset.
+	TLS *RedisTLS `json:"tls,omitempty"`
+
+	// NetworkPolicy restricts which clients can reach the Redis and Sentinel pods. The pods
+	// are reachable from anywhere when unset.
+	NetworkPolicy *RedisNetworkPolicy `json:"networkPolicy,omitempty"`
+}
+
+// RedisPasswordCharset is the set of characters a generated password is drawn from
+// +kubebuilder:validation:Enum=alphanumeric;symbols
+type RedisPasswordCharset string
+
+const (
+	// RedisPasswordCharsetAlphanumeric draws passwords from letters and digits
+	RedisPasswordCharsetAlphanumeric RedisPasswordCharset = "alphanumeric"
+	// RedisPasswordCharsetSymbols draws passwords from letters, digits and symbols that are
+	// safe to use in shell scripts and Redis configuration files
+	RedisPasswordCharsetSymbols RedisPasswordCharset = "symbols"
+)
+
+// RedisPasswordPolicy defines the generated Redis password
+type RedisPasswordPolicy struct {
+	// Length is the number of characters of the password
+	// +kubebuilder:default=32
+	// +kubebuilder:validation:Minimum=16
+	// +kubebuilder:validation:Maximum=128
+	Length int32 `json:"length,omitempty"`
+
+	// Charset is the set of characters the password is drawn from
+	// +kubebuilder:default=alphanumeric
+	Charset RedisPasswordCharset `json:"charset,omitempty"`
+}
+
+// RedisPasswordRotation defines how the generated Redis password is rotated
+type RedisPasswordRotation struct {
+	// Interval is the time between two automatic rotations, e.g. 2160h for a quarterly rotation.
+	// Passwords are only rotated on request when unset.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// GracePeriod is the time during which the previous password is still accepted after a
+	// rotation, giving clients the time to pick up the new password from the Secret
+	// +kubebuilder:default="5m"
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+// RedisService defines how the client Service exposes Redis
+type RedisService struct {
+	// Type is the type of the client Service
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +kubebuilder:default=ClusterIP
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Port is the port the client Service exposes Redis on
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default=6379
+	Port int32 `json:"port,omitempty"`
+
+	// Annotations are added to the client Service, e.g. to configure a cloud load balancer
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// LoadBalancerSourceRanges restricts the client CIDRs allowed through a LoadBalancer Service
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+}
+
+// RedisSentinel defines the Redis Sentinel quorum monitoring the primary
+type RedisSentinel struct {
+	// Replicas is the number of Sentinel pods
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=1
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Quorum is the number of Sentinels that need to agree the primary is down before a failover starts
+	// +kubebuilder:default=2
+	// +kubebuilder:validation:Minimum=1
+	Quorum int32 `json:"quorum,omitempty"`
+
+	// DownAfterMilliseconds is the time the primary must be unreachable before it is considered down
+	// +kubebuilder:default=5000
+	// +kubebuilder:validation:Minimum=1
+	DownAfterMilliseconds int32 `json:"downAfterMilliseconds,omitempty"`
+
+	// FailoverTimeoutMilliseconds is the time after which a failed failover is retried
+	// +kubebuilder:default=60000
+	// +kubebuilder:validation:Minimum=1
+	FailoverTimeoutMilliseconds int32 `json:"failoverTimeoutMilliseconds,omitempty"`
+}
+
+// RedisTLS defines the certificate the Redis and Sentinel servers present and whether
+// they still accept plaintext connections. Exactly one of SecretName and IssuerRef must be set.
+type RedisTLS struct {
+	// SecretName is the name of an existing Secret holding the tls.crt, tls.key and ca.crt keys.
+	// The Secret is neither owned nor modified by the operator.
+	SecretName string `json:"secretName,omitempty"`
+
+	// IssuerRef requests the certificate from this cert-manager issuer. The certificate is
+	// stored in the Secret "<name>-tls".
+	IssuerRef *RedisTLSIssuerRef `json:"issuerRef,omitempty"`
+
+	// DisablePlaintext closes the plaintext ports, so that clients can only connect over TLS
+	DisablePlaintext bool `json:"disablePlaintext,omitempty"`
+}
+
+// RedisTLSIssuerRef references the cert-manager issuer of the certificate
+type RedisTLSIssuerRef struct {
+	// Name is the name of the issuer
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Kind is the kind of the issuer, either Issuer or ClusterIssuer
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +kubebuilder:default=Issuer
+	Kind string `json:"kind,omitempty"`
+
+	// Group is the API group of the issuer
+	// +kubebuilder:default="cert-manager.io"
+	Group string `json:"group,omitempty"`
+}
+
+// RedisNetworkPolicy defines the clients allowed to connect to the Redis and Sentinel ports.
+// Traffic between the members of the instance and from the operator is always allowed.
+type RedisNetworkPolicy struct {
+	// NamespaceSelectors allow clients from every pod of the namespaces matching any selector
+	NamespaceSelectors []metav1.LabelSelector `json:"namespaceSelectors,omitempty"`
+
+	// PodSelectors allow clients from the pods matching any selector in the namespace of the instance
+	PodSelectors []metav1.LabelSelector `json:"podSelectors,omitempty"`
+
+	// CIDRs allow clients from the given IP blocks, such as "10.0.0.0/8"
+	CIDRs []RedisCIDR `json:"cidrs,omitempty"`
+
+	// MetricsNamespaceSelector selects the namespaces allowed to scrape the port named
+	// "metrics" of the pods, all namespaces when unset
+	MetricsNamespaceSelector *metav1.LabelSelector `json:"metricsNamespaceSelector,omitempty"`
+}
+
+// RedisCIDR is an IPv4 or IPv6 block in CIDR notation
+// +kubebuilder:validation:Format=cidr
+type RedisCIDR string
+
+// RedisPersistenceMode is how Redis persists its data
+// +kubebuilder:validation:Enum=none;rdb;aof;rdb+aof
+type RedisPersistenceMode string
+
+const (
+	// RedisPersistenceNone keeps the data in memory only, no volume is claimed
+	RedisPersistenceNone RedisPersistenceMode = "none"
+	// RedisPersistenceRDB takes point-in-time snapshots of the data
+	RedisPersistenceRDB RedisPersistenceMode = "rdb"
+	// RedisPersistenceAOF logs every write to an append only file
+	RedisPersistenceAOF RedisPersistenceMode = "aof"
+	// RedisPersistenceRDBAOF takes snapshots and logs every write
+	RedisPersistenceRDBAOF RedisPersistenceMode = "rdb+aof"
+)
+
+// RedisPersistence defines how Redis persists its data
+type RedisPersistence struct {
+	// Mode is the persistence mode. Only none runs without a persistent volume.
+	// +kubebuilder:default=rdb
+	Mode RedisPersistenceMode `json:"mode,omitempty"`
+
+	// Save lists the RDB snapshot schedules as "<seconds> <changes>", e.g. "3600 1" to snapshot
+	// hourly when at least one key changed. The Redis default schedules apply when empty.
+	Save []string `json:"save,omitempty"`
+
+	// AppendFsync is how often the append only file is flushed to disk
+	// +kubebuilder:validation:Enum=always;everysec;no
+	// +kubebuilder:default=everysec
+	AppendFsync string `json:"appendFsync,omitempty"`
+}
+
+// RedisRestoreSource defines where the data of a new Redis instance is restored from.
+// Exactly one source must be set.
+type RedisRestoreSource struct {
+	// BackupName is the name of a completed RedisBackup in the same namespace
+	BackupName string `json:"backupName,omitempty"`
+
+	// PVC reads the RDB file from a PersistentVolumeClaim
+	PVC *RedisRestorePVCSource `json:"pvc,omitempty"`
+
+	// S3 downloads the RDB file from an S3-compatible object store
+	S3 *RedisRestoreS3Source `json:"s3,omitempty"`
+
+	// VolumeSnapshotName is the name of a VolumeSnapshot in the same namespace the data
+	// volume of the first pod is provisioned from
+	VolumeSnapshotName string `json:"volumeSnapshotName,omitempty"`
+}
+
+// RedisRestorePVCSource defines the PersistentVolumeClaim an RDB file is restored from
+type RedisRestorePVCSource struct {
+	// ClaimName is the name of the PersistentVolumeClaim in the namespace of the Redis instance
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+
+	// Path is the path of the RDB file within the volume
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+}
+
+// RedisRestoreS3Source defines the object an RDB file is downloaded from
+type RedisRestoreS3Source struct {
+	// Endpoint is the URL of the object store, e.g. http://minio.minio.svc:9000
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+
+	// URL is the location of the RDB file as s3://<bucket>/<key>, as reported by the status of a RedisBackup
+	// +kubebuilder:validation:Pattern=`^s3://[^/]+/.+$`
+	URL string `json:"url"`
+
+	// CredentialsSecret is the name of the Secret holding the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY keys used to authenticate against the object store
+	// +kubebuilder:validation:MinLength=1
+	CredentialsSecret string `json:"credentialsSecret"`
+
+	// Image is the MinIO client image downloading the RDB file. It must provide sh.
+	// +kubebuilder:default="minio/mc"
+	Image string `json:"image,omitempty"`
 }
 
 // RedisStorage defines the storage requirements for Redis
+// +kubebuilder:validation:XValidation:rule=`has(self.storageClassName) == has(oldSelf.storageClassName) && (!has(self.storageClassName) || self.storageClassName == oldSelf.storageClassName)`,message="storageClassName is immutable"
+// +kubebuilder:validation:XValidation:rule=`!has(self.size) || !has(oldSelf.size) || !isQuantity(self.size) || !isQuantity(oldSelf.size) || quantity(self.size).compareTo(quantity(oldSelf.size)) >= 0`,message="size cannot shrink"
 type RedisStorage struct {
-	// Size is the size of the storage to allocate to each Redis instance
+	// Size is the size of the persistent volume claimed by each Redis pod for its data directory.
+	// Increasing it expands the existing volumes when their StorageClass allows volume expansion;
+	// volumes cannot shrink.
+	// +kubebuilder:validation:XValidation:rule=`self == '' || isQuantity(self)`,message="size must be a quantity such as 1Gi"
 	Size string `json:"size"`
 
-	// StorageClassName is the name of the StorageClass used for provisioning volumes
+	// StorageClassName is the name of the StorageClass used for provisioning volumes. VolumeSnapshot
+	// backups and restores need a StorageClass of a CSI driver supporting snapshots.
 	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// RetentionPolicy is whether the data volume claims are deleted or retained when the
+	// Redis instance is deleted. Retained claims are adopted by a new instance of the same name.
+	// +kubebuilder:default=Retain
+	RetentionPolicy RedisStorageRetentionPolicy `json:"retentionPolicy,omitempty"`
 }
 
+// RedisStorageRetentionPolicy is what happens to the data volume claims when the Redis instance is deleted
+// +kubebuilder:validation:Enum=Delete;Retain
+type RedisStorageRetentionPolicy string
+
+const (
+	// RedisStorageRetentionDelete deletes the data volume claims together with the instance
+	RedisStorageRetentionDelete RedisStorageRetentionPolicy = "Delete"
+	// RedisStorageRetentionRetain keeps the data volume claims after the instance is deleted
+	RedisStorageRetentionRetain RedisStorageRetentionPolicy = "Retain"
+)
+
 // RedisResources defines the CPU and memory resource requirements
+// +kubebuilder:validation:XValidation:rule=`!has(self.requests) || !has(self.limits) || !has(self.requests.cpu) || !has(self.limits.cpu) || !isQuantity(self.requests.cpu) || !isQuantity(self.limits.cpu) || quantity(self.requests.cpu).compareTo(quantity(self.limits.cpu)) <= 0`,message="cpu request must be less than or equal to the cpu limit"
+// +kubebuilder:validation:XValidation:rule=`!has(self.requests) || !has(self.limits) || !has(self.requests.memory) || !has(self.limits.memory) || !isQuantity(self.requests.memory) || !isQuantity(self.limits.memory) || quantity(self.requests.memory).compareTo(quantity(self.limits.memory)) <= 0`,message="memory request must be less than or equal to the memory limit"
 type RedisResources struct {
 	// Requests specifies the minimum amount of compute resources required.
-	Requests Requests `json:"requests"`
+	Requests Requests `json:"requests,omitempty"`
 	// Limits specifies the maximum amount of compute resources required.
 	Limits Limits `json:"limits,omitempty"`
+	// MaxMemoryPercent is the share of the memory limit Redis may use for data, set as maxmemory.
+	// The remainder is headroom for the copy-on-write memory of background saves and rewrites.
+	// It is ignored when spec.config sets maxmemory or no memory limit is set.
+	// +kubebuilder:default=75
+	// +kubebuilder:validation:Minimum=10
+	// +kubebuilder:validation:Maximum=100
+	MaxMemoryPercent int32 `json:"maxMemoryPercent,omitempty"`
 }
 
 type Requests struct {
 	// CPU request and limit
-	CPU string `json:"cpu"`
+	// +kubebuilder:validation:XValidation:rule=`self == '' || isQuantity(self)`,message="cpu must be a quantity such as 500m"
+	CPU string `json:"cpu,omitempty"`
 	// Memory request and limit
-	Memory string `json:"memory"`
+	// +kubebuilder:validation:XValidation:rule=`self == '' || isQuantity(self)`,message="memory must be a quantity such as 512Mi"
+	Memory string `json:"memory,omitempty"`
 }
 type Limits struct {
 	// CPU request and limit
-	CPU string `json:"cpu"`
+	// +kubebuilder:validation:XValidation:rule=`self == '' || isQuantity(self)`,message="cpu must be a quantity such as 500m"
+	CPU string `json:"cpu,omitempty"`
 	// Memory request and limit
-	Memory string `json:"memory"`
+	// +kubebuilder:validation:XValidation:rule=`self == '' || isQuantity(self)`,message="memory must be a quantity such as 512Mi"
+	Memory string `json:"memory,omitempty"`
 }
 
 // RedisStatus defines the observed state of Redis
@@ -81,8 +401,103 @@ type RedisStatus struct {
 	// TotalReplicas is the total number of desired replicas.
 	TotalReplicas int32 `json:"totalReplicas"`
 
+	// Primary is the name of the pod currently acting as the replication primary.
+	Primary string `json:"primary,omitempty"`
+
+	// Sentinel is the observed state of the Sentinel quorum, set once it has been provisioned.
+	Sentinel *RedisSentinelStatus `json:"sentinel,omitempty"`
+
+	// Cluster is the observed state of the Redis Cluster in cluster mode.
+	Cluster *RedisClusterStatus `json:"cluster,omitempty"`
+
+	// Config reports how spec.config has been applied to the running servers.
+	Config *RedisConfigStatus `json:"config,omitempty"`
+
+	// PasswordRotation is the state of the rotation of the generated password.
+	PasswordRotation *RedisPasswordRotationStatus `json:"passwordRotation,omitempty"`
+
+	// Storage is the state of the data volumes.
+	Storage *RedisStorageStatus `json:"storage,omitempty"`
+
+	// TLS is the certificate served by the Redis and Sentinel servers.
+	TLS *RedisTLSStatus `json:"tls,omitempty"`
+
 	// Conditions represent the latest available observations of an object's state.
-	Conditions []appsv1.DeploymentCondition `json:"conditions,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// RedisSentinelStatus defines the observed state of the Sentinel quorum
+type RedisSentinelStatus struct {
+	// ReadyReplicas is the number of Sentinels that are ready.
+	ReadyReplicas int32 `json:"readyReplicas"`
+}
+
+// RedisConfigStatus defines how spec.config has been applied
+type RedisConfigStatus struct {
+	// LiveDirectives are the directives applied to the running servers with CONFIG SET, without a restart
+	LiveDirectives []string `json:"liveDirectives,omitempty"`
+	// RestartDirectives are the directives that only take effect once the pods have restarted
+	RestartDirectives []string `json:"restartDirectives,omitempty"`
+	// LiveConfigHash is the hash of the directives last applied with CONFIG SET
+	LiveConfigHash string `json:"liveConfigHash,omitempty"`
+}
+
+// RedisStorageStatus defines the observed state of the data volumes
+type RedisStorageStatus struct {
+	// Capacity is the smallest capacity of the data volumes
+	Capacity string `json:"capacity,omitempty"`
+	// ResizingVolumes are the data volume claims still being expanded to spec.storage.size
+	ResizingVolumes []string `json:"resizingVolumes,omitempty"`
+}
+
+// RedisTLSStatus defines the certificate served by the Redis and Sentinel servers
+type RedisTLSStatus struct {
+	// SecretName is the name of the Secret the certificate is read from
+	SecretName string `json:"secretName,omitempty"`
+	// CertificateHash is the hash of the certificate, its key and the CA certificate. The pods
+	// restart when it changes, e.g. once cert-manager renews the certificate, since Redis and
+	// Sentinel only read the certificate when they start.
+	CertificateHash string `json:"certificateHash,omitempty"`
+}
+
+// RedisPasswordRotationStatus defines the observed state of the password rotation
+type RedisPasswordRotationStatus struct {
+	// LastRotationTime is the time the last rotation completed
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+	// PreviousPasswordExpiryTime is the time the previous password is revoked while a rotation is in progress
+	PreviousPasswordExpiryTime *metav1.Time `json:"previousPasswordExpiryTime,omitempty"`
+}
+
+// RedisClusterStatus defines the observed state of a Redis Cluster
+type RedisClusterStatus struct {
+	// State is the cluster_state reported by CLUSTER INFO, either ok or fail
+	State string `json:"state,omitempty"`
+	// SlotsAssigned is the number of hash slots assigned to a primary
+	SlotsAssigned int32 `json:"slotsAssigned"`
+	// SlotsOK is the number of hash slots served by a healthy primary
+	SlotsOK int32 `json:"slotsOk"`
+	// KnownNodes is the number of nodes that joined the cluster
+	KnownNodes int32 `json:"knownNodes"`
+	// Size is the number of primaries serving at least one hash slot
+	Size int32 `json:"size"`
+	// Shards is the number of shards currently provisioned. When shards are removed it
+	// stays above spec.shards until their hash slots have been migrated away.
+	Shards int32 `json:"shards,omitempty"`
+	// Rebalance is the progress of the hash slot migration started by a change of spec.shards.
+	// It is persisted so that a restarted operator resumes the migration where it stopped.
+	Rebalance *RedisClusterRebalance `json:"rebalance,omitempty"`
+}
+
+// RedisClusterRebalance defines the progress of a hash slot migration between shards
+type RedisClusterRebalance struct {
+	// TargetShards is the number of shards the hash slots are being spread across
+	TargetShards int32 `json:"targetShards"`
+	// SlotsMoved is the number of hash slots migrated so far
+	SlotsMoved int32 `json:"slotsMoved"`
+	// SlotsPending is the number of hash slots that still need to be migrated
+	SlotsPending int32 `json:"slotsPending"`
+	// StartTime is the time the migration started
+	StartTime metav1.Time `json:"startTime"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,363 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// minRedisMajor and minRedisMinor are the oldest supported Redis version. Sentinel hostname
+// resolution and the ACL and TLS support the operator relies on need Redis 6.2.
+const (
+	minRedisMajor = 6
+	minRedisMinor = 2
+)
+
+// minRedisClusterShards is the smallest Redis Cluster, whose primaries can still reach a
+// majority when one of them fails
+const minRedisClusterShards = 3
+
+// Defaults of the Redis spec. The version is pinned, so that instances deploy the same Redis
+// version until their spec changes.
+const (
+	defaultRedisImage         = "redis"
+	defaultRedisVersion       = "7.2.4"
+	defaultRedisCPURequest    = "100m"
+	defaultRedisMemoryRequest = "256Mi"
+	defaultRedisStorageSize   = "1Gi"
+	defaultRedisServicePort   = 6379
+	defaultRedisClusterShards = minRedisClusterShards
+	defaultRedisAppendFsync   = "everysec"
+)
+
+// redisVersionPattern matches Redis image tags such as 7.2, 7.2.4 or 7.2.4-alpine
+var redisVersionPattern = regexp.MustCompile(`^(\d+)\.(\d+)(\.\d+)?(-[0-9A-Za-z.-]+)?$`)
+
+// log is for logging in this package.
+var redislog = logf.Log.WithName("redis-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *Redis) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&redisWebhook{}).
+		WithValidator(&redisWebhook{}).
+		Complete()
+}
+
+//+kubebuilder:object:generate=false
+
+// redisWebhook defaults and validates Redis instances
+type redisWebhook struct{}
+
+//+kubebuilder:webhook:path=/mutate-cache-tc-v1alpha1-redis,mutating=true,failurePolicy=fail,sideEffects=None,groups=cache.tc,resources=redis,verbs=create;update,versions=v1alpha1,name=mredis.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomDefaulter = &redisWebhook{}
+
+// Default implements admission.CustomDefaulter so a webhook will be registered for the type
+func (w *redisWebhook) Default(_ context.Context, obj runtime.Object) error {
+	redis, err := asRedis(obj)
+	if err != nil {
+		return err
+	}
+	redislog.Info("default", "name", redis.Name)
+
+	defaultRedisSpec(&redis.Spec)
+	return nil
+}
+
+// defaultRedisSpec fills in the unset fields, so that the stored object shows the effective
+// configuration. Replicas is defaulted by the CRD schema, since 0 is a valid number of replicas.
+func defaultRedisSpec(spec *RedisSpec) {
+	if spec.Image == "" {
+		spec.Image = defaultRedisImage
+	}
+	if spec.Version == "" {
+		spec.Version = defaultRedisVersion
+	}
+	if spec.Mode == "" {
+		spec.Mode = RedisModeReplication
+	}
+	if spec.Mode == RedisModeCluster && spec.Shards == 0 {
+		spec.Shards = defaultRedisClusterShards
+	}
+
+	if spec.Persistence == nil {
+		spec.Persistence = &RedisPersistence{}
+	}
+	if spec.Persistence.Mode == "" {
+		spec.Persistence.Mode = RedisPersistenceRDB
+	}
+	if spec.Persistence.AppendFsync == "" {
+		spec.Persistence.AppendFsync = defaultRedisAppendFsync
+	}
+	if spec.Persistence.Mode != RedisPersistenceNone && spec.Storage.Size == "" {
+		spec.Storage.Size = defaultRedisStorageSize
+	}
+
+	// A request defaults to its limit when only the limit is set, as Kubernetes does. The memory
+	// limit bounds maxmemory, so it defaults to the request. The CPU limit is left unset, as
+	// throttling a single threaded Redis server stalls every client.
+	resources := &spec.Resources
+	if resources.Requests.CPU == "" {
+		resources.Requests.CPU = defaultRedisCPURequest
+		if resources.Limits.CPU != "" {
+			resources.Requests.CPU = resources.Limits.CPU
+		}
+	}
+	if resources.Requests.Memory == "" {
+		resources.Requests.Memory = defaultRedisMemoryRequest
+		if resources.Limits.Memory != "" {
+			resources.Requests.Memory = resources.Limits.Memory
+		}
+	}
+	if resources.Limits.Memory == "" {
+		resources.Limits.Memory = resources.Requests.Memory
+	}
+
+	if spec.Service == nil {
+		spec.Service = &RedisService{}
+	}
+	if spec.Service.Type == "" {
+		spec.Service.Type = corev1.ServiceTypeClusterIP
+	}
+	if spec.Service.Port == 0 {
+		spec.Service.Port = defaultRedisServicePort
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-cache-tc-v1alpha1-redis,mutating=false,failurePolicy=fail,sideEffects=None,groups=cache.tc,resources=redis,verbs=create;update,versions=v1alpha1,name=vredis.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomValidator = &redisWebhook{}
+
+// ValidateCreate implements admission.CustomValidator so a webhook will be registered for the type
+func (w *redisWebhook) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	redis, err := asRedis(obj)
+	if err != nil {
+		return nil, err
+	}
+	redislog.Info("validate create", "name", redis.Name)
+
+	return nil, redis.invalid(validateRedisSpec(&redis.Spec, field.NewPath("spec")))
+}
+
+// ValidateUpdate implements admission.CustomValidator so a webhook will be registered for the type
+func (w *redisWebhook) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	redis, err := asRedis(newObj)
+	if err != nil {
+		return nil, err
+	}
+	oldRedis, err := asRedis(oldObj)
+	if err != nil {
+		return nil, err
+	}
+	redislog.Info("validate update", "name", redis.Name)
+
+	// Finalizer, label and status updates of instances stored before a check was added, such
+	// as those with version latest, must not be rejected
+	if redis.DeletionTimestamp != nil || equality.Semantic.DeepEqual(redis.Spec, oldRedis.Spec) {
+		return nil, nil
+	}
+	specPath := field.NewPath("spec")
+	errs := validateRedisSpecUpdate(&redis.Spec, &oldRedis.Spec, specPath)
+	errs = append(errs, newErrors(validateRedisSpec(&redis.Spec, specPath), validateRedisSpec(&oldRedis.Spec, specPath))...)
+	return nil, redis.invalid(errs)
+}
+
+// newErrors returns the errors that the old object did not have, so that an update is only
+// rejected for the fields it makes invalid
+func newErrors(errs, oldErrs field.ErrorList) field.ErrorList {
+	result := field.ErrorList{}
+	for _, err := range errs {
+		if !containsError(oldErrs, err) {
+			result = append(result, err)
+		}
+	}
+	return result
+}
+
+// containsError reports whether the list holds an error of the same type, field and value
+func containsError(errs field.ErrorList, err *field.Error) bool {
+	for _, other := range errs {
+		if other.Type == err.Type && other.Field == err.Field && equality.Semantic.DeepEqual(other.BadValue, err.BadValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDelete implements admission.CustomValidator so a webhook will be registered for the type
+func (w *redisWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// asRedis returns the Redis instance the webhook was called for
+func asRedis(obj runtime.Object) (*Redis, error) {
+	redis, ok := obj.(*Redis)
+	if !ok {
+		return nil, fmt.Errorf("expected a Redis but got a %T", obj)
+	}
+	return redis, nil
+}
+
+// invalid returns the Invalid error of the given field errors, or nil when there are none
+func (r *Redis) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Redis").GroupKind(), r.Name, errs)
+}
+
+// validateRedisSpec validates the fields the CRD schema cannot, such as quantities and versions
+func validateRedisSpec(spec *RedisSpec, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if spec.Image == "" {
+		errs = append(errs, field.Required(path.Child("image"), "image is required"))
+	} else if imageHasTag(spec.Image) {
+		errs = append(errs, field.Invalid(path.Child("image"), spec.Image, "must not include a tag or digest, set spec.version instead"))
+	}
+	errs = append(errs, validateRedisVersion(spec.Version, path.Child("version"))...)
+
+	if spec.Mode == RedisModeCluster {
+		if spec.Replicas < 0 {
+			errs = append(errs, field.Invalid(path.Child("replicas"), spec.Replicas, "must be greater than or equal to 0"))
+		}
+		if spec.Shards < minRedisClusterShards {
+			errs = append(errs, field.Invalid(path.Child("shards"), spec.Shards, fmt.Sprintf("cluster mode needs at least %d shards", minRedisClusterShards)))
+		}
+		if spec.Sentinel != nil {
+			errs = append(errs, field.Forbidden(path.Child("sentinel"), "sentinel only applies to replication mode"))
+		}
+	} else if spec.Replicas < 1 {
+		errs = append(errs, field.Invalid(path.Child("replicas"), spec.Replicas, "replication mode needs at least 1 replica"))
+	}
+
+	if spec.Persistence == nil || spec.Persistence.Mode != RedisPersistenceNone {
+		sizePath := path.Child("storage", "size")
+		if spec.Storage.Size == "" {
+			errs = append(errs, field.Required(sizePath, "storage size is required unless persistence is disabled"))
+		} else if size, err := resource.ParseQuantity(spec.Storage.Size); err != nil {
+			errs = append(errs, field.Invalid(sizePath, spec.Storage.Size, err.Error()))
+		} else if size.Sign() <= 0 {
+			errs = append(errs, field.Invalid(sizePath, spec.Storage.Size, "must be greater than 0"))
+		}
+	}
+
+	errs = append(errs, validateRedisResources(&spec.Resources, path.Child("resources"))...)
+	return errs
+}
+
+// validateRedisVersion validates that the version is a pinned and supported Redis version
+func validateRedisVersion(version string, path *field.Path) field.ErrorList {
+	if version == "" {
+		return field.ErrorList{field.Required(path, "version is required")}
+	}
+	match := redisVersionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return field.ErrorList{field.Invalid(path, version, "must be a Redis version such as 7.2 or 7.2.4")}
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	if major < minRedisMajor || (major == minRedisMajor && minor < minRedisMinor) {
+		return field.ErrorList{field.Invalid(path, version, fmt.Sprintf("must be Redis %d.%d or later", minRedisMajor, minRedisMinor))}
+	}
+	return nil
+}
+
+// validateRedisResources validates the CPU and memory quantities and that no request
+// exceeds its limit. An empty limit leaves the resource unlimited.
+func validateRedisResources(resources *RedisResources, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	requestsPath := path.Child("requests")
+	limitsPath := path.Child("limits")
+
+	cpuRequest, cpuErrs := parseQuantity(resources.Requests.CPU, requestsPath.Child("cpu"), true)
+	memoryRequest, memoryErrs := parseQuantity(resources.Requests.Memory, requestsPath.Child("memory"), true)
+	errs = append(errs, cpuErrs...)
+	errs = append(errs, memoryErrs...)
+	cpuLimit, cpuErrs := parseQuantity(resources.Limits.CPU, limitsPath.Child("cpu"), false)
+	memoryLimit, memoryErrs := parseQuantity(resources.Limits.Memory, limitsPath.Child("memory"), false)
+	errs = append(errs, cpuErrs...)
+	errs = append(errs, memoryErrs...)
+
+	if cpuRequest != nil && cpuLimit != nil && cpuRequest.Cmp(*cpuLimit) > 0 {
+		errs = append(errs, field.Invalid(requestsPath.Child("cpu"), resources.Requests.CPU, "must be less than or equal to the cpu limit "+resources.Limits.CPU))
+	}
+	if memoryRequest != nil && memoryLimit != nil && memoryRequest.Cmp(*memoryLimit) > 0 {
+		errs = append(errs, field.Invalid(requestsPath.Child("memory"), resources.Requests.Memory, "must be less than or equal to the memory limit "+resources.Limits.Memory))
+	}
+	return errs
+}
+
+// parseQuantity parses a non-negative resource quantity. It returns nil without errors for
+// an empty optional quantity.
+func parseQuantity(value string, path *field.Path, required bool) (*resource.Quantity, field.ErrorList) {
+	if value == "" {
+		if required {
+			return nil, field.ErrorList{field.Required(path, "quantity is required")}
+		}
+		return nil, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return nil, field.ErrorList{field.Invalid(path, value, err.Error())}
+	}
+	if quantity.Sign() < 0 {
+		return nil, field.ErrorList{field.Invalid(path, value, "must be greater than or equal to 0")}
+	}
+	return &quantity, nil
+}
+
+// validateRedisSpecUpdate validates the changes of an update. The StorageClass of existing
+// volumes and the topology cannot change, and volumes cannot shrink.
+func validateRedisSpecUpdate(spec, oldSpec *RedisSpec, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	errs = append(errs, apivalidation.ValidateImmutableField(spec.Storage.StorageClassName, oldSpec.Storage.StorageClassName, path.Child("storage", "storageClassName"))...)
+	errs = append(errs, apivalidation.ValidateImmutableField(spec.Mode, oldSpec.Mode, path.Child("mode"))...)
+
+	size, err := resource.ParseQuantity(spec.Storage.Size)
+	oldSize, oldErr := resource.ParseQuantity(oldSpec.Storage.Size)
+	if err == nil && oldErr == nil && size.Cmp(oldSize) < 0 {
+		errs = append(errs, field.Forbidden(path.Child("storage", "size"), "volumes cannot shrink below "+oldSpec.Storage.Size))
+	}
+	return errs
+}
+
+// imageHasTag reports whether the image reference includes a tag or digest. A colon before
+// the last slash separates a registry port instead.
+func imageHasTag(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	return strings.Contains(image[strings.LastIndex(image, "/")+1:], ":")
+}
@@ -0,0 +1,213 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newValidRedis returns a Redis instance passing validation
+func newValidRedis() *Redis {
+	return &Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"},
+		Spec: RedisSpec{
+			Image:    "redis",
+			Version:  "7.2",
+			Replicas: 3,
+			Storage:  RedisStorage{Size: "1Gi", StorageClassName: "standard"},
+			Resources: RedisResources{
+				Requests: Requests{CPU: "100m", Memory: "128Mi"},
+				Limits:   Limits{CPU: "200m", Memory: "1Gi"},
+			},
+		},
+	}
+}
+
+// causeFields returns the field paths of the causes of an Invalid error
+func causeFields(t *testing.T, err error) []string {
+	assert.True(t, apierrors.IsInvalid(err), "Error should be an Invalid error")
+	statusErr, ok := err.(*apierrors.StatusError)
+	if !ok || statusErr.ErrStatus.Details == nil {
+		return nil
+	}
+	fields := []string{}
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	return fields
+}
+
+// TestValidateCreate tests that invalid instances are rejected with the paths of the invalid fields
+func TestValidateCreate(t *testing.T) {
+	_, err := (&redisWebhook{}).ValidateCreate(context.Background(), newValidRedis())
+	assert.NoError(t, err, "Valid instance should be admitted")
+
+	tests := []struct {
+		name   string
+		modify func(redis *Redis)
+		field  string
+	}{
+		{"empty image", func(redis *Redis) { redis.Spec.Image = "" }, "spec.image"},
+		{"image tag", func(redis *Redis) { redis.Spec.Image = "redis:7.2" }, "spec.image"},
+		{"latest version", func(redis *Redis) { redis.Spec.Version = "latest" }, "spec.version"},
+		{"old version", func(redis *Redis) { redis.Spec.Version = "5.0.14" }, "spec.version"},
+		{"negative replicas", func(redis *Redis) { redis.Spec.Replicas = -1 }, "spec.replicas"},
+		{"invalid quantity", func(redis *Redis) { redis.Spec.Resources.Limits.Memory = "512MB" }, "spec.resources.limits.memory"},
+		{"missing request", func(redis *Redis) { redis.Spec.Resources.Requests.CPU = "" }, "spec.resources.requests.cpu"},
+		{"request above limit", func(redis *Redis) { redis.Spec.Resources.Requests.CPU = "1" }, "spec.resources.requests.cpu"},
+		{"missing storage size", func(redis *Redis) { redis.Spec.Storage.Size = "" }, "spec.storage.size"},
+		{"no replicas in replication mode", func(redis *Redis) { redis.Spec.Replicas = 0 }, "spec.replicas"},
+		{"too few shards", func(redis *Redis) {
+			redis.Spec.Mode = RedisModeCluster
+			redis.Spec.Shards = 2
+		}, "spec.shards"},
+		{"sentinel in cluster mode", func(redis *Redis) {
+			redis.Spec.Mode = RedisModeCluster
+			redis.Spec.Shards = 3
+			redis.Spec.Sentinel = &RedisSentinel{}
+		}, "spec.sentinel"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			redis := newValidRedis()
+			tt.modify(redis)
+
+			// Act
+			_, err := (&redisWebhook{}).ValidateCreate(context.Background(), redis)
+
+			// Assert
+			assert.Equal(t, []string{tt.field}, causeFields(t, err), "Only the invalid field should be reported")
+		})
+	}
+}
+
+// TestValidateCreateOptionalFields tests that patch versions, registry ports, empty limits and disabled persistence are admitted
+func TestValidateCreateOptionalFields(t *testing.T) {
+	// Arrange
+	redis := newValidRedis()
+	redis.Spec.Image = "registry.local:5000/redis"
+	redis.Spec.Version = "7.2.4-alpine"
+	redis.Spec.Resources.Limits = Limits{}
+	redis.Spec.Storage = RedisStorage{}
+	redis.Spec.Persistence = &RedisPersistence{Mode: RedisPersistenceNone}
+
+	// Act
+	_, err := (&redisWebhook{}).ValidateCreate(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "Optional fields should be admitted")
+}
+
+// TestValidateUpdate tests that the StorageClass and mode are immutable and volumes cannot shrink
+func TestValidateUpdate(t *testing.T) {
+	// Arrange
+	old := newValidRedis()
+	grown := newValidRedis()
+	grown.Spec.Storage.Size = "2Gi"
+	changed := newValidRedis()
+	changed.Spec.Storage.StorageClassName = "fast"
+	changed.Spec.Mode = RedisModeCluster
+	changed.Spec.Shards = 3
+	changed.Spec.Storage.Size = "512Mi"
+
+	// Act
+	_, grownErr := (&redisWebhook{}).ValidateUpdate(context.Background(), old, grown)
+	_, changedErr := (&redisWebhook{}).ValidateUpdate(context.Background(), old, changed)
+
+	// Assert
+	assert.NoError(t, grownErr, "Volumes should be allowed to grow")
+	assert.Equal(t, []string{"spec.storage.storageClassName", "spec.mode", "spec.storage.size"}, causeFields(t, changedErr), "Immutable fields and shrinking should be reported")
+}
+
+// TestValidateUpdateExistingErrors tests that instances stored before a check was added can be updated and deleted
+func TestValidateUpdateExistingErrors(t *testing.T) {
+	// Arrange
+	old := newValidRedis()
+	old.Spec.Version = "latest"
+	finalized := old.DeepCopy()
+	finalized.Finalizers = []string{"cache.tc/finalizer"}
+	deleting := old.DeepCopy()
+	deleting.DeletionTimestamp = &metav1.Time{}
+	deleting.Spec.Storage.Size = "512Mi"
+	scaled := old.DeepCopy()
+	scaled.Spec.Replicas = 5
+	broken := old.DeepCopy()
+	broken.Spec.Replicas = 0
+
+	// Act
+	_, finalizedErr := (&redisWebhook{}).ValidateUpdate(context.Background(), old, finalized)
+	_, deletingErr := (&redisWebhook{}).ValidateUpdate(context.Background(), old, deleting)
+	_, scaledErr := (&redisWebhook{}).ValidateUpdate(context.Background(), old, scaled)
+	_, brokenErr := (&redisWebhook{}).ValidateUpdate(context.Background(), old, broken)
+
+	// Assert
+	assert.NoError(t, finalizedErr, "Updates leaving the spec unchanged should be admitted")
+	assert.NoError(t, deletingErr, "Updates of instances being deleted should be admitted")
+	assert.NoError(t, scaledErr, "Updates should not be rejected for fields they leave invalid")
+	assert.Equal(t, []string{"spec.replicas"}, causeFields(t, brokenErr), "Only the fields the update makes invalid should be reported")
+}
+
+// TestDefault tests that a minimal instance is defaulted to a valid and pinned configuration
+func TestDefault(t *testing.T) {
+	// Arrange
+	redis := &Redis{ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"}}
+	// Replicas is defaulted by the CRD schema before the webhook is called
+	redis.Spec.Replicas = 1
+
+	// Act
+	assert.NoError(t, (&redisWebhook{}).Default(context.Background(), redis))
+	_, err := (&redisWebhook{}).ValidateCreate(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "Defaulted instance should be valid")
+	assert.Equal(t, "redis", redis.Spec.Image, "Image should be defaulted")
+	assert.Equal(t, defaultRedisVersion, redis.Spec.Version, "Version should be pinned")
+	assert.Equal(t, RedisModeReplication, redis.Spec.Mode, "Mode should be defaulted")
+	assert.Equal(t, RedisPersistenceRDB, redis.Spec.Persistence.Mode, "Persistence should be defaulted")
+	assert.Equal(t, "1Gi", redis.Spec.Storage.Size, "Storage size should be defaulted")
+	assert.Equal(t, "100m", redis.Spec.Resources.Requests.CPU, "CPU request should be defaulted")
+	assert.Equal(t, "256Mi", redis.Spec.Resources.Limits.Memory, "Memory limit should default to the memory request")
+	assert.Empty(t, redis.Spec.Resources.Limits.CPU, "CPU limit should be left unset")
+	assert.Equal(t, int32(6379), redis.Spec.Service.Port, "Service port should be defaulted")
+}
+
+// TestDefaultKeepsSetFields tests that set fields are kept and only apply where they are relevant
+func TestDefaultKeepsSetFields(t *testing.T) {
+	// Arrange
+	redis := newValidRedis()
+	redis.Spec.Mode = RedisModeCluster
+	redis.Spec.Persistence = &RedisPersistence{Mode: RedisPersistenceNone}
+	redis.Spec.Storage = RedisStorage{}
+	redis.Spec.Resources.Requests.Memory = "1Gi"
+	redis.Spec.Resources.Limits.Memory = ""
+
+	// Act
+	assert.NoError(t, (&redisWebhook{}).Default(context.Background(), redis))
+
+	// Assert
+	assert.Equal(t, "7.2", redis.Spec.Version, "Set version should be kept")
+	assert.Equal(t, int32(3), redis.Spec.Shards, "Shards should be defaulted in cluster mode")
+	assert.Empty(t, redis.Spec.Storage.Size, "Storage size should not be defaulted without persistence")
+	assert.Equal(t, "1Gi", redis.Spec.Resources.Limits.Memory, "Memory limit should default to the set memory request")
+	assert.Equal(t, "200m", redis.Spec.Resources.Limits.CPU, "Set CPU limit should be kept")
+}
+
+// TestDefaultLimitOnly tests that requests default to the limits when only the limits are set
+func TestDefaultLimitOnly(t *testing.T) {
+	// Arrange
+	redis := newValidRedis()
+	redis.Spec.Resources = RedisResources{Limits: Limits{CPU: "50m", Memory: "128Mi"}}
+
+	// Act
+	assert.NoError(t, (&redisWebhook{}).Default(context.Background(), redis))
+	_, err := (&redisWebhook{}).ValidateCreate(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "Defaulted instance should be valid")
+	assert.Equal(t, "50m", redis.Spec.Resources.Requests.CPU, "CPU request should default to the CPU limit")
+	assert.Equal(t, "128Mi", redis.Spec.Resources.Requests.Memory, "Memory request should default to the memory limit")
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisBackupPhase is the lifecycle phase of a backup
+type RedisBackupPhase string
+
+const (
+	// RedisBackupPending waits for the Redis instance to be backed up
+	RedisBackupPending RedisBackupPhase = "Pending"
+	// RedisBackupRunning saves the data of the primary and copies the RDB file to the target
+	RedisBackupRunning RedisBackupPhase = "Running"
+	// RedisBackupCompleted has copied the RDB file to the target
+	RedisBackupCompleted RedisBackupPhase = "Completed"
+	// RedisBackupFailed could not back up the Redis instance
+	RedisBackupFailed RedisBackupPhase = "Failed"
+)
+
+// RedisBackupSpec defines the desired state of RedisBackup
+type RedisBackupSpec struct {
+	// RedisName is the name of the Redis instance in the same namespace to back up
+	// +kubebuilder:validation:MinLength=1
+	RedisName string `json:"redisName"`
+
+	// Target is where the RDB file is copied to, or how the data volumes are snapshotted.
+	// Exactly one target must be set.
+	Target RedisBackupTarget `json:"target"`
+}
+
+// RedisBackupTarget defines where the RDB file of a backup is copied to
+type RedisBackupTarget struct {
+	// PVC copies the RDB file to a PersistentVolumeClaim
+	PVC *RedisBackupPVCTarget `json:"pvc,omitempty"`
+
+	// S3 uploads the RDB file to an S3-compatible object store such as MinIO
+	S3 *RedisBackupS3Target `json:"s3,omitempty"`
+
+	// VolumeSnapshot takes a CSI VolumeSnapshot of every data volume once the RDB file is saved
+	VolumeSnapshot *RedisBackupVolumeSnapshotTarget `json:"volumeSnapshot,omitempty"`
+}
+
+// RedisBackupPVCTarget defines the PersistentVolumeClaim a backup is copied to
+type RedisBackupPVCTarget struct {
+	// ClaimName is the name of the PersistentVolumeClaim in the namespace of the backup
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+
+	// Path is the directory within the volume the RDB file is copied to, the volume root when empty
+	Path string `json:"path,omitempty"`
+}
+
+// RedisBackupS3Target defines the S3-compatible bucket a backup is uploaded to
+type RedisBackupS3Target struct {
+	// Endpoint is the URL of the object store, e.g. http://minio.minio.svc:9000
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+
+	// Bucket is the name of the bucket the RDB file is uploaded to
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// Prefix is prepended to the name of the uploaded object
+	Prefix string `json:"prefix,omitempty"`
+
+	// CredentialsSecret is the name of the Secret holding the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY keys used to authenticate against the object store
+	// +kubebuilder:validation:MinLength=1
+	CredentialsSecret string `json:"credentialsSecret"`
+
+	// Image is the MinIO client image uploading the RDB file. It must provide sh.
+	// +kubebuilder:default="minio/mc"
+	Image string `json:"image,omitempty"`
+}
+
+// RedisBackupVolumeSnapshotTarget defines the CSI VolumeSnapshots a backup takes
+type RedisBackupVolumeSnapshotTarget struct {
+	// VolumeSnapshotClassName is the VolumeSnapshotClass of the snapshots, the default class
+	// of the CSI driver of the data volumes when empty
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// RedisBackupStatus defines the observed state of RedisBackup
+type RedisBackupStatus struct {
+	// Phase is the lifecycle phase of the backup
+	Phase RedisBackupPhase `json:"phase,omitempty"`
+
+	// StartTime is the time the primary was asked to save its data
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time the RDB file was copied to the target
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Duration is how long the backup took from start to completion
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// Size is the size of the RDB file in bytes, or the restore size of the snapshot of the primary data volume
+	Size int64 `json:"size,omitempty"`
+	// Checksum is the SHA-256 checksum of the RDB file, as sha256:<hex>
+	Checksum string `json:"checksum,omitempty"`
+	// Location is where the RDB file was copied to, as pvc://<claim>/<path> or s3://<bucket>/<key>,
+	// or the snapshot of the primary data volume as volumesnapshot://<name>
+	Location string `json:"location,omitempty"`
+
+	// VolumeSnapshots are the names of the VolumeSnapshots taken of the data volumes
+	VolumeSnapshots []string `json:"volumeSnapshots,omitempty"`
+
+	// Message explains why the backup is waiting or failed
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Redis",type=string,JSONPath=`.spec.redisName`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.status.size`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// RedisBackup is the Schema for the redisbackups API
+type RedisBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisBackupSpec   `json:"spec,omitempty"`
+	Status RedisBackupStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RedisBackupList contains a list of RedisBackup
+type RedisBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RedisBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RedisBackup{}, &RedisBackupList{})
+}
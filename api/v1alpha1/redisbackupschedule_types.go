@@ -0,0 +1,87 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisBackupScheduleSpec defines the desired state of RedisBackupSchedule
+type RedisBackupScheduleSpec struct {
+	// Schedule is when backups are taken in cron syntax, e.g. "0 3 * * *", evaluated in UTC.
+	// The @hourly, @daily, @weekly, @monthly and @yearly shorthands are supported.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// Suspend stops new backups from being taken
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Template is the spec of the backups taken on schedule
+	Template RedisBackupSpec `json:"template"`
+
+	// SuccessfulBackupsHistoryLimit is the number of completed backups kept
+	// +kubebuilder:default=5
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulBackupsHistoryLimit *int32 `json:"successfulBackupsHistoryLimit,omitempty"`
+
+	// FailedBackupsHistoryLimit is the number of failed backups kept
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=0
+	FailedBackupsHistoryLimit *int32 `json:"failedBackupsHistoryLimit,omitempty"`
+}
+
+// RedisBackupScheduleStatus defines the observed state of RedisBackupSchedule
+type RedisBackupScheduleStatus struct {
+	// LastScheduleTime is the time the last backup was scheduled
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// NextScheduleTime is the time the next backup is scheduled
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	// LastBackup is the name of the last backup taken on schedule
+	LastBackup string `json:"lastBackup,omitempty"`
+
+	// Conditions represent the latest available observations of an object's state.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Last Backup",type=string,JSONPath=`.status.lastBackup`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// RedisBackupSchedule is the Schema for the redisbackupschedules API
+type RedisBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisBackupScheduleSpec   `json:"spec,omitempty"`
+	Status RedisBackupScheduleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RedisBackupScheduleList contains a list of RedisBackupSchedule
+type RedisBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RedisBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RedisBackupSchedule{}, &RedisBackupScheduleList{})
+}
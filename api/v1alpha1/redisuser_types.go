@@ -0,0 +1,98 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedisACLCommandRule allows or denies a command or command category, such as "+@read" or "-keys"
+// +kubebuilder:validation:Pattern=`^[+-][^\s]+$`
+type RedisACLCommandRule string
+
+// RedisUserSpec defines the desired state of RedisUser
+type RedisUserSpec struct {
+	// RedisName is the name of the Redis instance in the same namespace the user is set up on
+	// +kubebuilder:validation:MinLength=1
+	RedisName string `json:"redisName"`
+
+	// Username is the name of the ACL user, the name of the RedisUser when empty. The default
+	// user is managed by the operator and cannot be used.
+	// +kubebuilder:validation:Pattern=`^[^\s]+$`
+	Username string `json:"username,omitempty"`
+
+	// Commands are the ACL command rules of the user in order, such as "+@read", "-@dangerous"
+	// or "+get". The user may not run any command when empty.
+	Commands []RedisACLCommandRule `json:"commands,omitempty"`
+
+	// Keys are the key patterns the user may access, such as "metrics:*". The user may not
+	// access any key when empty.
+	Keys []string `json:"keys,omitempty"`
+
+	// Channels are the Pub/Sub channel patterns the user may access. The user may not access
+	// any channel when empty.
+	Channels []string `json:"channels,omitempty"`
+
+	// SecretName is the name of an existing Secret holding the password of the user. The
+	// operator generates the Secret "<name>-user-secret" when empty.
+	SecretName string `json:"secretName,omitempty"`
+
+	// SecretKey is the key of the password in the Secret
+	// +kubebuilder:default="password"
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// RedisUserStatus defines the observed state of RedisUser
+type RedisUserStatus struct {
+	// Username is the name of the ACL user set up on the Redis servers
+	Username string `json:"username,omitempty"`
+
+	// SecretName is the name of the Secret holding the password of the user
+	SecretName string `json:"secretName,omitempty"`
+
+	// Conditions represent the latest available observations of an object's state.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Redis",type=string,JSONPath=`.spec.redisName`
+//+kubebuilder:printcolumn:name="Username",type=string,JSONPath=`.status.username`
+//+kubebuilder:printcolumn:name="Applied",type=string,JSONPath=`.status.conditions[?(@.type=="Applied")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// RedisUser is the Schema for the redisusers API
+type RedisUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedisUserSpec   `json:"spec,omitempty"`
+	Status RedisUserStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RedisUserList contains a list of RedisUser
+type RedisUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []RedisUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&RedisUser{}, &RedisUserList{})
+}
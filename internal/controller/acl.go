@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// redisUserFinalizer deletes the ACL user from the Redis servers before the RedisUser is removed
+	redisUserFinalizer = "redisuser.cache.tc/finalizer"
+	// defaultRedisUsername is the user the operator, replication and Sentinel authenticate as
+	defaultRedisUsername = "default"
+	// userRequeueInterval is how often a user that cannot be set up yet is retried
+	userRequeueInterval = 10 * time.Second
+)
+
+// userError reports why the ACL user cannot be set up. Its reason is surfaced in the Applied
+// condition.
+type userError struct {
+	reason  string
+	message string
+}
+
+func (e *userError) Error() string {
+	return e.message
+}
+
+// aclUsername returns the name of the ACL user, which defaults to the name of the RedisUser
+func aclUsername(user *cachev1alpha1.RedisUser) string {
+	if user.Spec.Username != "" {
+		return user.Spec.Username
+	}
+	return user.Name
+}
+
+// managedUserSecretName returns the name of the Secret generated for the password of the user
+func managedUserSecretName(user *cachev1alpha1.RedisUser) string {
+	return user.Name + "-user-secret"
+}
+
+// userSecretName returns the name of the Secret holding the password of the user, which is
+// either the Secret supplied by the user or the one generated by the operator
+func userSecretName(user *cachev1alpha1.RedisUser) string {
+	if user.Spec.SecretName != "" {
+		return user.Spec.SecretName
+	}
+	return managedUserSecretName(user)
+}
+
+// userSecretKey returns the key of the password in the Secret of the user
+func userSecretKey(user *cachev1alpha1.RedisUser) string {
+	if user.Spec.SecretKey != "" {
+		return user.Spec.SecretKey
+	}
+	return defaultSecretKey
+}
+
+// validateRedisUser rejects users the operator cannot manage. The default user holds the
+// password of the Redis instance, which clients share.
+func validateRedisUser(user *cachev1alpha1.RedisUser) error {
+	if aclUsername(user) == defaultRedisUsername {
+		return &userError{reason: "InvalidUser", message: "the default user is managed by the operator through the Redis password"}
+	}
+	return nil
+}
+
+// aclPasswordHash returns the ACL rule setting the password by its SHA-256 hash, so that the
+// password does not show up in ACL LIST
+func aclPasswordHash(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return "#" + hex.EncodeToString(sum[:])
+}
+
+// aclSetUserArgs returns the ACL SETUSER command replacing every rule of the user with the
+// ones of the RedisUser, so that applying it again is idempotent
+func aclSetUserArgs(user *cachev1alpha1.RedisUser, password string) []interface{} {
+	args := []interface{}{"ACL", "SETUSER", aclUsername(user), "reset", "on", aclPasswordHash(password)}
+	for _, key := range user.Spec.Keys {
+		args = append(args, "~"+key)
+	}
+	for _, channel := range user.Spec.Channels {
+		args = append(args, "&"+channel)
+	}
+	for _, command := range user.Spec.Commands {
+		args = append(args, string(command))
+	}
+	return args
+}
+
+// createUserSecret returns a new Secret holding the generated password of the user
+func (r *RedisUserReconciler) createUserSecret(user *cachev1alpha1.RedisUser, password string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      managedUserSecretName(user),
+			Namespace: user.Namespace,
+			Labels:    map[string]string{"app": user.Spec.RedisName},
+		},
+		Data: map[string][]byte{
+			userSecretKey(user): []byte(password),
+		},
+	}
+	// Set the RedisUser as the owner of the Secret
+	if err := controllerutil.SetControllerReference(user, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newUserReconciler returns a RedisUserReconciler backed by a fake client holding the given objects
+func newUserReconciler(t *testing.T, objs ...client.Object) *RedisUserReconciler {
+	scheme := newTestReconciler(t).Scheme
+	c := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&cachev1alpha1.RedisUser{}).WithObjects(objs...).Build()
+	return &RedisUserReconciler{Client: c, Scheme: scheme}
+}
+
+// newRedisUser returns a read-only RedisUser of the test-redis instance
+func newRedisUser() *cachev1alpha1.RedisUser {
+	return &cachev1alpha1.RedisUser{
+		ObjectMeta: metav1.ObjectMeta{Name: "analytics", Namespace: "default"},
+		Spec: cachev1alpha1.RedisUserSpec{
+			RedisName: "test-redis",
+			Commands:  []cachev1alpha1.RedisACLCommandRule{"+@read", "-keys"},
+			Keys:      []string{"metrics:*"},
+			Channels:  []string{"events"},
+		},
+	}
+}
+
+// TestAclSetUserArgs tests that the ACL rules reset the user and set the hashed password, keys, channels and commands
+func TestAclSetUserArgs(t *testing.T) {
+	// Arrange
+	user := newRedisUser()
+
+	// Act
+	args := aclSetUserArgs(user, "secret")
+
+	// Assert
+	assert.Equal(t, []interface{}{
+		"ACL", "SETUSER", "analytics", "reset", "on",
+		"#2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+		"~metrics:*", "&events", "+@read", "-keys",
+	}, args, "Rules should replace the user with the hashed password and the spec rules")
+	user.Spec.Username = "reports"
+	assert.Equal(t, "reports", aclSetUserArgs(user, "secret")[2], "spec.username should name the ACL user")
+}
+
+// TestValidateRedisUser tests that the default user cannot be managed through a RedisUser
+func TestValidateRedisUser(t *testing.T) {
+	user := newRedisUser()
+	assert.NoError(t, validateRedisUser(user), "Named user should be valid")
+
+	user.Spec.Username = "default"
+	var userErr *userError
+	assert.ErrorAs(t, validateRedisUser(user), &userErr, "Default user should be rejected")
+	assert.Equal(t, "InvalidUser", userErr.reason, "Default user should be reported as invalid")
+}
+
+// TestReconcileUserSecret tests that a password Secret is generated unless an existing one is referenced
+func TestReconcileUserSecret(t *testing.T) {
+	// Arrange
+	user := newRedisUser()
+	referenced := newRedisUser()
+	referenced.Spec.SecretName = "missing"
+	r := newUserReconciler(t, user)
+
+	// Act
+	secretName, password, err := r.reconcileUserSecret(context.Background(), user)
+	_, _, missingErr := r.reconcileUserSecret(context.Background(), referenced)
+
+	// Assert
+	assert.NoError(t, err, "reconcileUserSecret should not return an error")
+	assert.Equal(t, "analytics-user-secret", secretName, "Secret name should be derived from the RedisUser name")
+	assert.Len(t, password, defaultPasswordLength, "Password should be generated")
+	secret := &corev1.Secret{}
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: secretName, Namespace: "default"}, secret))
+	assert.Equal(t, password, string(secret.Data["password"]), "Generated password should be stored in the Secret")
+	assert.True(t, metav1.IsControlledBy(secret, user), "Generated Secret should be owned by the RedisUser")
+	var userErr *userError
+	assert.ErrorAs(t, missingErr, &userErr, "Missing Secret should be reported as a userError")
+	assert.Equal(t, "SecretNotFound", userErr.reason, "Missing Secret should be reported")
+}
+
+// TestRedisUserReconcileRedisNotFound tests that a RedisUser of a missing instance is reported and retried
+func TestRedisUserReconcileRedisNotFound(t *testing.T) {
+	// Arrange
+	r := newUserReconciler(t, newRedisUser())
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "analytics", Namespace: "default"}}
+
+	// Act
+	result, err := r.Reconcile(context.Background(), req)
+
+	// Assert
+	assert.NoError(t, err, "Reconcile should not return an error")
+	assert.Equal(t, userRequeueInterval, result.RequeueAfter, "Missing instance should be retried")
+	user := &cachev1alpha1.RedisUser{}
+	assert.NoError(t, r.Get(context.Background(), req.NamespacedName, user))
+	assert.Contains(t, user.Finalizers, redisUserFinalizer, "Finalizer should be added")
+	condition := meta.FindStatusCondition(user.Status.Conditions, typeAppliedRedisUser)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status, "Applied should be false")
+	assert.Equal(t, "RedisNotFound", condition.Reason, "Missing instance should be reported")
+}
+
+// TestRedisUserReconcileDelete tests that a RedisUser of a deleted instance is removed without cleanup
+func TestRedisUserReconcileDelete(t *testing.T) {
+	// Arrange
+	user := newRedisUser()
+	now := metav1.Now()
+	user.DeletionTimestamp = &now
+	user.Finalizers = []string{redisUserFinalizer}
+	user.Status.Username = "analytics"
+	r := newUserReconciler(t, user)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "analytics", Namespace: "default"}}
+
+	// Act
+	_, err := r.Reconcile(context.Background(), req)
+
+	// Assert
+	assert.NoError(t, err, "Reconcile should not return an error")
+	err = r.Get(context.Background(), req.NamespacedName, &cachev1alpha1.RedisUser{})
+	assert.True(t, errors.IsNotFound(err), "RedisUser should be removed once its finalizer is")
+}
+
+// TestUsersForRedis tests that Redis pods and instances are mapped to the RedisUsers of the instance
+func TestUsersForRedis(t *testing.T) {
+	// Arrange
+	other := newRedisUser()
+	other.Name = "other"
+	other.Spec.RedisName = "other-redis"
+	r := newUserReconciler(t, newRedisUser(), other)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-redis-0", Namespace: "default", Labels: map[string]string{"app": "test-redis"}}}
+	redis := &cachev1alpha1.Redis{ObjectMeta: metav1.ObjectMeta{Name: "other-redis", Namespace: "default"}}
+
+	// Act
+	podRequests := r.usersForRedis(context.Background(), pod)
+	redisRequests := r.usersForRedis(context.Background(), redis)
+
+	// Assert
+	assert.Len(t, podRequests, 1, "Pod should be mapped to the users of its instance")
+	assert.Equal(t, "analytics", podRequests[0].Name, "Pod should be mapped to the users of its instance")
+	assert.Len(t, redisRequests, 1, "Instance should be mapped to its users")
+	assert.Equal(t, "other", redisRequests[0].Name, "Instance should be mapped to its users")
+}
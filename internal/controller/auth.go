@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// redisConfigDir is the directory the startup scripts render the Redis configuration to
+	redisConfigDir = "/etc/redis"
+	// redisConfigVolumeName is the name of the volume holding the rendered Redis configuration
+	redisConfigVolumeName = "config"
+)
+
+// passwordScript returns the shell snippet setting PASSWORD to the password from
+// REDIS_PASSWORD, escaped to be quoted in a Redis configuration file. Configuration files
+// written afterwards are only readable by the Redis user, and the pod refuses to start
+// without a password rather than running unauthenticated.
+func passwordScript() string {
+	return `if [ -z "${REDIS_PASSWORD}" ]; then
+  echo "REDIS_PASSWORD is not set, refusing to start without authentication" >&2
+  exit 1
+fi
+PASSWORD=$(printf '%s' "${REDIS_PASSWORD}" | sed 's/[\\"]/\\&/g')
+umask 077
+`
+}
+
+// redisAuthConfigScript returns the shell snippet rendering redis.conf, which includes the
+// configuration from spec.config followed by the password required from clients and used to
+// authenticate against the primary. Unlike command line arguments the configuration file
+// does not expose the password in the process list.
+func redisAuthConfigScript() string {
+	return passwordScript() + fmt.Sprintf(`cat > %s/redis.conf <<EOF
+include %s/%s
+requirepass "${PASSWORD}"
+masterauth "${PASSWORD}"
+EOF
+`, redisConfigDir, redisConfigMapDir, redisConfigFile)
+}
+
+// verifyAuthentication checks that every running Redis server rejects an unauthenticated
+// PING and reports the result in the AuthenticationEnforced condition. Servers that cannot
+// be reached are skipped, as are instances without running pods.
+func (r *RedisReconciler) verifyAuthentication(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	logger := log.FromContext(ctx)
+
+	pods, err := listRedisPods(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+
+	verified := 0
+	unauthenticated := []string{}
+	for i := range pods {
+		rdb := newRedisClient(&pods[i], tlsConfig, "")
+		err := rdb.Ping(ctx).Err()
+		rdb.Close()
+		switch {
+		case err == nil:
+			unauthenticated = append(unauthenticated, pods[i].Name)
+		case strings.HasPrefix(err.Error(), "NOAUTH"):
+			verified++
+		default:
+			logger.Info("Could not verify Redis authentication", "Pod.Name", pods[i].Name, "Reason", err.Error())
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               typeAuthenticationEnforcedRedis,
+		Status:             metav1.ConditionTrue,
+		Reason:             "PingRejected",
+		Message:            fmt.Sprintf("Unauthenticated PING was rejected by %d Redis servers", verified),
+		ObservedGeneration: redis.Generation,
+	}
+	if len(unauthenticated) > 0 {
+		logger.Info("Redis servers accept unauthenticated clients", "Pods", unauthenticated)
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "UnauthenticatedAccess"
+		condition.Message = fmt.Sprintf("Unauthenticated PING was accepted by %s", strings.Join(unauthenticated, ", "))
+	} else if verified == 0 {
+		return nil
+	}
+	meta.SetStatusCondition(&redis.Status.Conditions, condition)
+	return nil
+}
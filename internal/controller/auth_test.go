@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPasswordScript tests that the password is escaped for a quoted Redis configuration value
+func TestPasswordScript(t *testing.T) {
+	// Arrange
+	cmd := exec.Command("sh", "-c", passwordScript()+`printf '%s' "${PASSWORD}"`)
+	cmd.Env = []string{`REDIS_PASSWORD=pa"ss\word$`}
+
+	// Act
+	output, err := cmd.Output()
+
+	// Assert
+	assert.NoError(t, err, "Script should succeed when the password is set")
+	assert.Equal(t, `pa\"ss\\word$`, string(output), "Quotes and backslashes should be escaped")
+}
+
+// TestPasswordScriptWithoutPassword tests that Redis refuses to start without a password
+func TestPasswordScriptWithoutPassword(t *testing.T) {
+	// Arrange
+	cmd := exec.Command("sh", "-c", passwordScript()+"echo started")
+
+	// Act
+	output, err := cmd.Output()
+
+	// Assert
+	assert.Error(t, err, "Script should fail without a password")
+	assert.NotContains(t, string(output), "started", "Redis should not be started")
+}
@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// backupLabel labels the Job copying the RDB file with the name of its backup
+	backupLabel = "cache.tc/backup"
+	// backupScheduleLabel labels the backups taken by a RedisBackupSchedule with its name
+	backupScheduleLabel = "cache.tc/backup-schedule"
+	// backupPodAnnotation records on the backup the primary pod that was asked to save its data
+	backupPodAnnotation = "cache.tc/backup-pod"
+	// backupLastSaveAnnotation records on the backup the LASTSAVE of the primary before BGSAVE,
+	// so that the save is known to be complete once LASTSAVE moves past it
+	backupLastSaveAnnotation = "cache.tc/last-save"
+	// backupSaveTimeAnnotation records on the backup the server TIME of BGSAVE, so that a failed
+	// save can be told apart from the status of an earlier one
+	backupSaveTimeAnnotation = "cache.tc/save-time"
+	// backupPollInterval is how often the progress of BGSAVE is checked
+	backupPollInterval = 5 * time.Second
+	// backupSaveTimeout is how long the background save of a backup may take, including the time
+	// it is deferred by an append only file rewrite, before the backup fails
+	backupSaveTimeout = time.Hour
+	// backupSaveRetryDelay covers the 5 seconds Redis waits before starting a scheduled save
+	// after a failed one, after which a scheduled save has been attempted once no child runs
+	backupSaveRetryDelay = 10 * time.Second
+	// backupWorkDir is where the RDB file is staged before being uploaded to an object store
+	backupWorkDir = "/backup"
+	// backupTargetDir is where the target PersistentVolumeClaim is mounted
+	backupTargetDir = "/target"
+	// backupCopyContainerName is the name of the container copying the RDB file, which
+	// reports the size and checksum of the copy in its termination message
+	backupCopyContainerName = "copy"
+	// backupS3Alias is the name of the object store in the MinIO client configuration
+	backupS3Alias = "target"
+	// minioClientConfigDir is where the MinIO client keeps its configuration, which must be
+	// writable whatever user the image runs as
+	minioClientConfigDir = "/tmp/.mc"
+	// defaultBackupS3Image is the MinIO client image used when the S3 target sets no image
+	defaultBackupS3Image = "minio/mc"
+	// defaultRDBFilename is the name of the RDB file unless spec.config sets dbfilename
+	defaultRDBFilename = "dump.rdb"
+)
+
+// backupResult is the termination message of the container copying the RDB file
+type backupResult struct {
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// backupJobName returns the name of the Job copying the RDB file of the backup
+func backupJobName(backup *cachev1alpha1.RedisBackup) string {
+	return backup.Name + "-backup"
+}
+
+// backupFileName returns the name the RDB file is copied to
+func backupFileName(backup *cachev1alpha1.RedisBackup) string {
+	return backup.Name + ".rdb"
+}
+
+// backupObjectKey returns the key of the RDB file uploaded to an object store
+func backupObjectKey(backup *cachev1alpha1.RedisBackup) string {
+	return path.Join(backup.Spec.Target.S3.Prefix, backupFileName(backup))
+}
+
+// backupPVCPath returns the path of the RDB file within the target volume, which cannot escape the volume
+func backupPVCPath(backup *cachev1alpha1.RedisBackup) string {
+	return path.Join("/", backup.Spec.Target.PVC.Path, backupFileName(backup))
+}
+
+// backupLocation returns where the RDB file of the backup is copied to
+func backupLocation(backup *cachev1alpha1.RedisBackup) string {
+	if backup.Spec.Target.VolumeSnapshot != nil {
+		return volumeSnapshotLocation(backupPrimarySnapshotName(backup))
+	}
+	if target := backup.Spec.Target.S3; target != nil {
+		return fmt.Sprintf("s3://%s/%s", target.Bucket, backupObjectKey(backup))
+	}
+	return fmt.Sprintf("pvc://%s%s", backup.Spec.Target.PVC.ClaimName, backupPVCPath(backup))
+}
+
+// rdbFilenameForRedis returns the name of the RDB file Redis saves its data to
+func rdbFilenameForRedis(redis *cachev1alpha1.Redis) string {
+	if filename := redisConfig(redis)["dbfilename"]; filename != "" {
+		return filename
+	}
+	return defaultRDBFilename
+}
+
+// validateBackupTarget checks that exactly one target is set and that the object store endpoint is a URL
+func validateBackupTarget(target cachev1alpha1.RedisBackupTarget) error {
+	targets := 0
+	for _, set := range []bool{target.PVC != nil, target.S3 != nil, target.VolumeSnapshot != nil} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("exactly one of target.pvc, target.s3 and target.volumeSnapshot must be set")
+	}
+	if target.S3 != nil {
+		endpoint, err := url.Parse(target.S3.Endpoint)
+		if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			return fmt.Errorf("target.s3.endpoint %q must be an http or https URL", target.S3.Endpoint)
+		}
+	}
+	return nil
+}
+
+// backupCopyScript returns the shell script copying the RDB file from SOURCE to DESTINATION
+// and reporting the size and checksum of the copy in the termination message
+func backupCopyScript() string {
+	return `set -e
+mkdir -p "$(dirname "${DESTINATION}")"
+cp "${SOURCE}" "${DESTINATION}"
+SIZE=$(stat -c %s "${DESTINATION}")
+CHECKSUM=$(sha256sum "${DESTINATION}" | cut -d ' ' -f 1)
+printf '{"size":%s,"checksum":"sha256:%s"}' "${SIZE}" "${CHECKSUM}" > /dev/termination-log
+`
+}
+
+// jobForBackup returns the Job copying the RDB file saved by the given primary pod to the
+// target of the backup. The Job mounts the data volume of the primary read-only, so it is
+// scheduled on the node of the primary. Uploads to an object store are staged in an emptyDir
+// volume by an init container before the MinIO client uploads them.
+func (r *RedisBackupReconciler) jobForBackup(backup *cachev1alpha1.RedisBackup, redis *cachev1alpha1.Redis, primary string) (*batchv1.Job, error) {
+	labels := map[string]string{backupLabel: backup.Name}
+	source := path.Join(redisDataDir, rdbFilenameForRedis(redis))
+
+	copyContainer := corev1.Container{
+		Name:    backupCopyContainerName,
+		Image:   redis.Spec.Image + ":" + redis.Spec.Version,
+		Command: []string{"sh", "-c", backupCopyScript()},
+		Env: []corev1.EnvVar{
+			{Name: "SOURCE", Value: source},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: dataVolumeName, MountPath: redisDataDir, ReadOnly: true},
+		},
+	}
+	volumes := []corev1.Volume{
+		{
+			Name: dataVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: dataVolumeName + "-" + primary,
+					ReadOnly:  true,
+				},
+			},
+		},
+	}
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Affinity: &corev1.Affinity{
+			PodAffinity: &corev1.PodAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"statefulset.kubernetes.io/pod-name": primary},
+					},
+					TopologyKey: corev1.LabelHostname,
+				}},
+			},
+		},
+	}
+
+	if target := backup.Spec.Target.PVC; target != nil {
+		copyContainer.Env = append(copyContainer.Env, corev1.EnvVar{Name: "DESTINATION", Value: backupTargetDir + backupPVCPath(backup)})
+		copyContainer.VolumeMounts = append(copyContainer.VolumeMounts, corev1.VolumeMount{Name: "target", MountPath: backupTargetDir})
+		volumes = append(volumes, corev1.Volume{
+			Name: "target",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: target.ClaimName},
+			},
+		})
+		podSpec.Containers = []corev1.Container{copyContainer}
+	} else {
+		target := backup.Spec.Target.S3
+		endpoint, err := url.Parse(target.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		image := target.Image
+		if image == "" {
+			image = defaultBackupS3Image
+		}
+		staged := path.Join(backupWorkDir, backupFileName(backup))
+
+		copyContainer.Env = append(copyContainer.Env, corev1.EnvVar{Name: "DESTINATION", Value: staged})
+		copyContainer.VolumeMounts = append(copyContainer.VolumeMounts, corev1.VolumeMount{Name: "work", MountPath: backupWorkDir})
+		volumes = append(volumes, corev1.Volume{
+			Name:         "work",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		podSpec.InitContainers = []corev1.Container{copyContainer}
+		podSpec.Containers = []corev1.Container{{
+			Name:         "upload",
+			Image:        image,
+			Command:      minioClientCommand("cp", "--quiet", staged, path.Join(backupS3Alias, target.Bucket, backupObjectKey(backup))),
+			Env:          minioClientEnv(endpoint, target.CredentialsSecret),
+			VolumeMounts: []corev1.VolumeMount{{Name: "work", MountPath: backupWorkDir, ReadOnly: true}},
+		}}
+	}
+	podSpec.Volumes = volumes
+
+	backoffLimit := int32(2)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupJobName(backup),
+			Namespace: backup.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       podSpec,
+			},
+		},
+	}
+	if err := controllerutil.SetControllerReference(backup, job, r.Scheme); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// minioClientEnv returns the environment configuring the object store as the backupS3Alias
+// of the MinIO client, with the credentials read from the given Secret
+func minioClientEnv(endpoint *url.URL, credentialsSecret string) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: "AWS_ACCESS_KEY_ID", ValueFrom: secretKeyEnvSource(credentialsSecret, "AWS_ACCESS_KEY_ID")},
+		{Name: "AWS_SECRET_ACCESS_KEY", ValueFrom: secretKeyEnvSource(credentialsSecret, "AWS_SECRET_ACCESS_KEY")},
+		{Name: "S3_ENDPOINT", Value: endpoint.Scheme + "://" + endpoint.Host},
+	}
+}
+
+// minioClientCommand returns the command running the MinIO client with the given arguments
+// once the object store of minioClientEnv is set up as the backupS3Alias. The credentials are
+// passed as arguments rather than in the MC_HOST_<alias> URL, which mangles secret keys
+// containing / or +. The arguments are passed to the script as positional parameters, so
+// that they need no quoting.
+func minioClientCommand(args ...string) []string {
+	script := fmt.Sprintf(`mc --config-dir %[1]s alias set %[2]s "$S3_ENDPOINT" "$AWS_ACCESS_KEY_ID" "$AWS_SECRET_ACCESS_KEY" >/dev/null && exec mc --config-dir %[1]s "$@"`,
+		minioClientConfigDir, backupS3Alias)
+	return append([]string{"sh", "-c", script, "mc"}, args...)
+}
+
+// secretKeyEnvSource returns the source of an environment variable read from a Secret key
+func secretKeyEnvSource(secretName, key string) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+			Key:                  key,
+		},
+	}
+}
+
+// backupResultFromPods returns the size and checksum reported by the copy container of the
+// Job pods. It reports false when no copy container has terminated successfully.
+func backupResultFromPods(pods []corev1.Pod) (backupResult, bool) {
+	for _, pod := range pods {
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			terminated := status.State.Terminated
+			if status.Name != backupCopyContainerName || terminated == nil || terminated.ExitCode != 0 {
+				continue
+			}
+			result := backupResult{}
+			if err := json.Unmarshal([]byte(terminated.Message), &result); err == nil && result.Checksum != "" {
+				return result, true
+			}
+		}
+	}
+	return backupResult{}, false
+}
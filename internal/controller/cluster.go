@@ -0,0 +1,456 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	goredis "github.com/redis/go-redis/v9"
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// clusterSlots is the number of hash slots of a Redis Cluster
+	clusterSlots = 16384
+	// clusterBusPortOffset is added to the port of a Redis Cluster node to get its gossip port
+	clusterBusPortOffset = 10000
+	// clusterNodeTimeout is the time in milliseconds after which an unreachable node is considered failing
+	clusterNodeTimeout = 5000
+)
+
+// isClusterMode reports whether the Redis instance runs as a Redis Cluster
+func isClusterMode(redis *cachev1alpha1.Redis) bool {
+	return redis.Spec.Mode == cachev1alpha1.RedisModeCluster
+}
+
+// desiredReplicas returns the number of Redis pods of the StatefulSet. In cluster mode
+// every shard is a contiguous group of one primary followed by its replicas.
+func desiredReplicas(redis *cachev1alpha1.Redis) int32 {
+	if isClusterMode(redis) {
+		return clusterShards(redis) * (1 + redis.Spec.ReplicasPerShard)
+	}
+	return redis.Spec.Replicas
+}
+
+// clusterShards returns the number of shards to provision. Shards being removed are kept
+// until their hash slots have been migrated to the remaining shards.
+func clusterShards(redis *cachev1alpha1.Redis) int32 {
+	if redis.Status.Cluster != nil && redis.Status.Cluster.Shards > redis.Spec.Shards {
+		return redis.Status.Cluster.Shards
+	}
+	return redis.Spec.Shards
+}
+
+// podOrdinal returns the StatefulSet ordinal of a Redis pod
+func podOrdinal(redis *cachev1alpha1.Redis, pod string) (int, error) {
+	return strconv.Atoi(strings.TrimPrefix(pod, redis.Name+"-"))
+}
+
+// shardOfOrdinal returns the shard the pod with the given ordinal belongs to
+func shardOfOrdinal(redis *cachev1alpha1.Redis, ordinal int) int {
+	return ordinal / int(1+redis.Spec.ReplicasPerShard)
+}
+
+// clusterStartupScript returns the shell script starting redis-server as a Redis Cluster node.
+// The node configuration is kept on the data volume so a restarted pod keeps its node ID.
+// With TLS enabled the cluster bus listens on the TLS port plus 10000.
+func clusterStartupScript(redis *cachev1alpha1.Redis) string {
+	return fmt.Sprintf(`set -e
+%[5]sexec redis-server %[6]s/redis.conf --port %[1]d --dir %[2]s --cluster-enabled yes --cluster-config-file %[3]s/nodes.conf --cluster-node-timeout %[4]d
+`, redisListenPort(redis), redisDataDir, redisDataDir, clusterNodeTimeout, redisAuthConfigScript(), redisConfigDir)
+}
+
+// clusterBusPortForRedis returns the port Redis Cluster nodes gossip on, which Redis derives
+// from the port the cluster is reached on
+func clusterBusPortForRedis(redis *cachev1alpha1.Redis) int {
+	return redisServerPort(redis) + clusterBusPortOffset
+}
+
+// slotRange is an inclusive range of hash slots
+type slotRange struct {
+	Start int
+	End   int
+}
+
+// slotRanges splits the hash slots evenly across the given number of shards.
+// The first shards receive one extra slot when the slots do not divide evenly.
+func slotRanges(shards int) []slotRange {
+	ranges := make([]slotRange, 0, shards)
+	start := 0
+	for i := 0; i < shards; i++ {
+		size := clusterSlots / shards
+		if i < clusterSlots%shards {
+			size++
+		}
+		ranges = append(ranges, slotRange{Start: start, End: start + size - 1})
+		start += size
+	}
+	return ranges
+}
+
+// clusterNode is a node as reported by CLUSTER NODES
+type clusterNode struct {
+	ID       string
+	IP       string
+	Myself   bool
+	Master   bool
+	Failed   bool
+	MasterID string
+	Slots    []slotRange
+	// Migrating maps the slots being migrated away from the node to the ID of the target node
+	Migrating map[int]string
+}
+
+// slotCount returns the number of hash slots the node serves
+func (n clusterNode) slotCount() int {
+	count := 0
+	for _, slots := range n.Slots {
+		count += slots.End - slots.Start + 1
+	}
+	return count
+}
+
+// parseClusterNodes parses the output of CLUSTER NODES. Slots that are being
+// migrated or imported are reported as [slot->-id] or [slot-<-id] and are not
+// counted as served, the migrations are recorded on the node instead.
+func parseClusterNodes(output string) []clusterNode {
+	nodes := []clusterNode{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		node := clusterNode{ID: fields[0]}
+		// ip:port@cport[,hostname]
+		if host, _, found := strings.Cut(fields[1], ":"); found {
+			node.IP = host
+		}
+		for _, flag := range strings.Split(fields[2], ",") {
+			switch flag {
+			case "myself":
+				node.Myself = true
+			case "master":
+				node.Master = true
+			case "fail", "noaddr":
+				node.Failed = true
+			}
+		}
+		if fields[3] != "-" {
+			node.MasterID = fields[3]
+		}
+		for _, slot := range fields[8:] {
+			if strings.HasPrefix(slot, "[") {
+				migrating, target, found := strings.Cut(strings.Trim(slot, "[]"), "->-")
+				if number, err := strconv.Atoi(migrating); found && err == nil {
+					if node.Migrating == nil {
+						node.Migrating = map[int]string{}
+					}
+					node.Migrating[number] = target
+				}
+				continue
+			}
+			start, end, isRange := strings.Cut(slot, "-")
+			if !isRange {
+				end = start
+			}
+			first, err := strconv.Atoi(start)
+			if err != nil {
+				continue
+			}
+			last, err := strconv.Atoi(end)
+			if err != nil {
+				continue
+			}
+			node.Slots = append(node.Slots, slotRange{Start: first, End: last})
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// parseInfoFields parses the key:value lines returned by INFO style commands such as CLUSTER INFO
+func parseInfoFields(output string) map[string]string {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if found {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// clusterMember is a Redis pod together with its view of the cluster
+type clusterMember struct {
+	pod    *corev1.Pod
+	client *goredis.Client
+	nodes  []clusterNode
+}
+
+// self returns the cluster node of the member itself
+func (m *clusterMember) self() *clusterNode {
+	for i := range m.nodes {
+		if m.nodes[i].Myself {
+			return &m.nodes[i]
+		}
+	}
+	return nil
+}
+
+// knows reports whether the member's view of the cluster contains a node with the given IP
+func (m *clusterMember) knows(ip string) bool {
+	for _, node := range m.nodes {
+		if node.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileCluster forms a Redis Cluster out of the Redis pods. It introduces every pod
+// to the first one with CLUSTER MEET, assigns unassigned hash slots to the primary of the
+// shard owning them and makes the remaining pods of each shard replicate that primary.
+// When the number of shards changes, hash slots are migrated in batches and the nodes of
+// removed shards are forgotten once drained. The observed cluster state is recorded in
+// the status of the Redis instance.
+func (r *RedisReconciler) reconcileCluster(ctx context.Context, redis *cachev1alpha1.Redis, password string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pods, err := listRedisPods(ctx, r.Client, redis)
+	if err != nil {
+		logger.Error(err, "Failed to list Redis pods")
+		return ctrl.Result{}, err
+	}
+	if len(pods) < int(desiredReplicas(redis)) {
+		logger.Info("Waiting for all Redis pods to run before forming the cluster", "Running", len(pods), "Desired", desiredReplicas(redis))
+		return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+	}
+
+	members, err := r.connectClusterMembers(ctx, redis, pods, password)
+	defer func() {
+		for _, member := range members {
+			member.client.Close()
+		}
+	}()
+	if err != nil {
+		logger.Info("Redis pod is not ready to join the cluster yet", "Reason", err.Error())
+		return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+	}
+
+	// Introduce every pod to the first one, gossip spreads them to the rest of the cluster
+	seed := members[0]
+	met := false
+	for _, member := range members[1:] {
+		if seed.knows(member.pod.Status.PodIP) {
+			continue
+		}
+		logger.Info("Adding Redis pod to the cluster", "Pod.Name", member.pod.Name)
+		if err := seed.client.ClusterMeet(ctx, member.pod.Status.PodIP, strconv.Itoa(redisServerPort(redis))).Err(); err != nil {
+			return ctrl.Result{}, err
+		}
+		met = true
+	}
+	if met {
+		// Wait for the handshakes to complete before assigning slots
+		return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+	}
+
+	shards := groupShards(redis, members)
+	if err := assignUnassignedSlots(ctx, redis, seed, shards); err != nil {
+		logger.Error(err, "Failed to assign hash slots")
+		return ctrl.Result{}, err
+	}
+	if err := replicateShardPrimaries(ctx, redis, shards); err != nil {
+		logger.Error(err, "Failed to configure shard replicas")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.observeCluster(ctx, redis, seed); err != nil {
+		logger.Error(err, "Failed to read cluster state")
+		return ctrl.Result{}, err
+	}
+
+	// Move hash slots to added shards or away from removed ones
+	rebalanced, err := r.rebalanceCluster(ctx, redis, members, shards, password)
+	if err != nil {
+		logger.Error(err, "Failed to rebalance hash slots")
+		return ctrl.Result{}, err
+	}
+	if !rebalanced {
+		// Persist the progress and continue with the next batch of slots
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if err := forgetRemovedNodes(ctx, members); err != nil {
+		logger.Error(err, "Failed to forget removed cluster nodes")
+		return ctrl.Result{}, err
+	}
+
+	if redis.Status.Cluster.State != "ok" {
+		return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// connectClusterMembers connects to every Redis pod in ordinal order and reads its view of the cluster.
+// The returned members must be closed by the caller, even when an error is returned.
+func (r *RedisReconciler) connectClusterMembers(ctx context.Context, redis *cachev1alpha1.Redis, pods []corev1.Pod, password string) ([]*clusterMember, error) {
+	sort.Slice(pods, func(i, j int) bool {
+		a, _ := podOrdinal(redis, pods[i].Name)
+		b, _ := podOrdinal(redis, pods[j].Name)
+		return a < b
+	})
+
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*clusterMember, 0, len(pods))
+	for i := range pods {
+		member := &clusterMember{pod: &pods[i], client: newRedisClient(&pods[i], tlsConfig, password)}
+		members = append(members, member)
+		output, err := member.client.ClusterNodes(ctx).Result()
+		if err != nil {
+			return members, fmt.Errorf("pod %s: %w", pods[i].Name, err)
+		}
+		member.nodes = parseClusterNodes(output)
+		if member.self() == nil {
+			return members, fmt.Errorf("pod %s did not report itself in CLUSTER NODES", pods[i].Name)
+		}
+	}
+	return members, nil
+}
+
+// groupShards groups the cluster members by the shard their ordinal belongs to,
+// including the shards that are being removed
+func groupShards(redis *cachev1alpha1.Redis, members []*clusterMember) [][]*clusterMember {
+	shards := make([][]*clusterMember, clusterShards(redis))
+	for _, member := range members {
+		ordinal, err := podOrdinal(redis, member.pod.Name)
+		if err != nil {
+			continue
+		}
+		shard := shardOfOrdinal(redis, ordinal)
+		if shard < len(shards) {
+			shards[shard] = append(shards[shard], member)
+		}
+	}
+	return shards
+}
+
+// shardPrimary returns the member acting as primary of the shard: the one serving slots,
+// or the first pod of the shard while no member serves any slot.
+func shardPrimary(shard []*clusterMember) *clusterMember {
+	for _, member := range shard {
+		if self := member.self(); self.Master && self.slotCount() > 0 {
+			return member
+		}
+	}
+	return shard[0]
+}
+
+// assignUnassignedSlots assigns every hash slot no primary serves yet to the primary of the
+// shard whose even share of slots contains it
+func assignUnassignedSlots(ctx context.Context, redis *cachev1alpha1.Redis, seed *clusterMember, shards [][]*clusterMember) error {
+	logger := log.FromContext(ctx)
+
+	assigned := make([]bool, clusterSlots)
+	for _, node := range seed.nodes {
+		for _, slots := range node.Slots {
+			for slot := slots.Start; slot <= slots.End; slot++ {
+				assigned[slot] = true
+			}
+		}
+		// Slots being migrated are owned by their source until the migration completes
+		for slot := range node.Migrating {
+			assigned[slot] = true
+		}
+	}
+
+	for shard, slots := range slotRanges(int(redis.Spec.Shards)) {
+		if shard >= len(shards) || len(shards[shard]) == 0 {
+			continue
+		}
+		primary := shardPrimary(shards[shard])
+		for start := slots.Start; start <= slots.End; start++ {
+			if assigned[start] {
+				continue
+			}
+			end := start
+			for end+1 <= slots.End && !assigned[end+1] {
+				end++
+			}
+			logger.Info("Assigning hash slots", "Pod.Name", primary.pod.Name, "Start", start, "End", end)
+			if err := primary.client.ClusterAddSlotsRange(ctx, start, end).Err(); err != nil {
+				return err
+			}
+			start = end
+		}
+	}
+	return nil
+}
+
+// replicateShardPrimaries makes every member of a shard that serves no slots replicate the shard
+// primary. Shards that are being removed are left alone, their nodes are drained and forgotten.
+func replicateShardPrimaries(ctx context.Context, redis *cachev1alpha1.Redis, shards [][]*clusterMember) error {
+	logger := log.FromContext(ctx)
+
+	for index, shard := range shards {
+		if index >= int(redis.Spec.Shards) || len(shard) == 0 {
+			continue
+		}
+		primary := shardPrimary(shard)
+		if !primary.self().Master {
+			continue
+		}
+		primaryID := primary.self().ID
+		for _, member := range shard {
+			if member == primary {
+				continue
+			}
+			self := member.self()
+			if self.MasterID == primaryID || self.slotCount() > 0 {
+				continue
+			}
+			// A replica can only be attached once it learned about the primary through gossip
+			if !member.knows(primary.pod.Status.PodIP) {
+				continue
+			}
+			logger.Info("Configuring Redis pod as shard replica", "Pod.Name", member.pod.Name, "Primary", primary.pod.Name)
+			if err := member.client.ClusterReplicate(ctx, primaryID).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// observeCluster records the cluster state reported by CLUSTER INFO in the status
+func (r *RedisReconciler) observeCluster(ctx context.Context, redis *cachev1alpha1.Redis, member *clusterMember) error {
+	output, err := member.client.ClusterInfo(ctx).Result()
+	if err != nil {
+		return err
+	}
+	info := parseInfoFields(output)
+	atoi := func(key string) int32 {
+		value, _ := strconv.Atoi(info[key])
+		return int32(value)
+	}
+	if redis.Status.Cluster == nil {
+		redis.Status.Cluster = &cachev1alpha1.RedisClusterStatus{}
+	}
+	redis.Status.Cluster.State = info["cluster_state"]
+	redis.Status.Cluster.SlotsAssigned = atoi("cluster_slots_assigned")
+	redis.Status.Cluster.SlotsOK = atoi("cluster_slots_ok")
+	redis.Status.Cluster.KnownNodes = atoi("cluster_known_nodes")
+	redis.Status.Cluster.Size = atoi("cluster_size")
+	return nil
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestSlotRanges tests that the hash slots are split evenly and completely across shards
+func TestSlotRanges(t *testing.T) {
+	ranges := slotRanges(3)
+
+	assert.Equal(t, []slotRange{{0, 5461}, {5462, 10922}, {10923, 16383}}, ranges, "Slots should be split evenly")
+
+	ranges = slotRanges(1)
+	assert.Equal(t, []slotRange{{0, 16383}}, ranges, "A single shard should serve every slot")
+}
+
+// TestDesiredReplicas tests the number of pods of each topology
+func TestDesiredReplicas(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		Spec: cachev1alpha1.RedisSpec{
+			Replicas:         2,
+			Shards:           3,
+			ReplicasPerShard: 1,
+		},
+	}
+
+	assert.Equal(t, int32(2), desiredReplicas(redis), "Replication mode should use Replicas")
+
+	redis.Spec.Mode = cachev1alpha1.RedisModeCluster
+	assert.Equal(t, int32(6), desiredReplicas(redis), "Cluster mode should run a primary and its replicas per shard")
+}
+
+// TestShardOfOrdinal tests that pods are grouped in contiguous shards
+func TestShardOfOrdinal(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis"},
+		Spec: cachev1alpha1.RedisSpec{
+			Mode:             cachev1alpha1.RedisModeCluster,
+			Shards:           3,
+			ReplicasPerShard: 1,
+		},
+	}
+
+	ordinal, err := podOrdinal(redis, "test-redis-3")
+	assert.NoError(t, err, "podOrdinal should parse the pod ordinal")
+	assert.Equal(t, 3, ordinal, "Ordinal should match the pod name")
+	assert.Equal(t, 1, shardOfOrdinal(redis, ordinal), "Fourth pod should belong to the second shard")
+	assert.Equal(t, 0, shardOfOrdinal(redis, 1), "Second pod should replicate the first shard")
+}
+
+// TestParseClusterNodes tests parsing the output of CLUSTER NODES
+func TestParseClusterNodes(t *testing.T) {
+	output := `07c37dfeb235213a872192d90877d0cd55635b91 10.0.0.1:6379@16379 myself,master - 0 1426238317239 4 connected 0-5460 5462 [5461->-e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca]
+e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 10.0.0.2:6379@16379,redis-1 master - 0 1426238316232 1 connected 5461
+292f8b365bb7edb5e285caf0b7e6ddc7265d2f4f 10.0.0.3:6379@16379 slave,fail 07c37dfeb235213a872192d90877d0cd55635b91 0 1426238318243 4 connected
+`
+
+	nodes := parseClusterNodes(output)
+
+	assert.Len(t, nodes, 3, "Every node should be parsed")
+	assert.Equal(t, "07c37dfeb235213a872192d90877d0cd55635b91", nodes[0].ID, "Node ID should be parsed")
+	assert.Equal(t, "10.0.0.1", nodes[0].IP, "Node IP should be parsed")
+	assert.True(t, nodes[0].Myself, "Myself flag should be parsed")
+	assert.True(t, nodes[0].Master, "Master flag should be parsed")
+	assert.Equal(t, []slotRange{{0, 5460}, {5462, 5462}}, nodes[0].Slots, "Migrating slots should be skipped")
+	assert.Equal(t, 5462, nodes[0].slotCount(), "Slot count should add up the ranges")
+	assert.Equal(t, map[int]string{5461: "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca"}, nodes[0].Migrating, "Migrating slots should be recorded")
+	assert.Equal(t, "10.0.0.2", nodes[1].IP, "Announced hostname should be ignored")
+	assert.False(t, nodes[2].Master, "Replica should not be a master")
+	assert.True(t, nodes[2].Failed, "Fail flag should be parsed")
+	assert.Equal(t, nodes[0].ID, nodes[2].MasterID, "Replica should reference its primary")
+}
+
+// TestParseInfoFields tests parsing the output of CLUSTER INFO
+func TestParseInfoFields(t *testing.T) {
+	output := "cluster_state:ok\r\ncluster_slots_assigned:16384\r\ncluster_known_nodes:6\r\n"
+
+	info := parseInfoFields(output)
+
+	assert.Equal(t, "ok", info["cluster_state"], "Cluster state should be parsed")
+	assert.Equal(t, "16384", info["cluster_slots_assigned"], "Assigned slots should be parsed")
+	assert.Equal(t, "6", info["cluster_known_nodes"], "Known nodes should be parsed")
+}
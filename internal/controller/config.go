@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// redisConfigFile is the key of the ConfigMap holding the rendered spec.config
+	redisConfigFile = "redis.conf"
+	// redisConfigMapVolumeName is the name of the volume the ConfigMap is mounted from
+	redisConfigMapVolumeName = "redis-conf"
+	// redisConfigMapDir is the directory the ConfigMap is mounted to
+	redisConfigMapDir = "/etc/redis-conf"
+	// configHashAnnotation records the hash of the rendered configuration on the pod template,
+	// so that configuration changes roll the pods
+	configHashAnnotation = "cache.tc/config-hash"
+	// defaultMaxMemoryPercent is the share of the memory limit used as maxmemory when resources.maxMemoryPercent is not set
+	defaultMaxMemoryPercent = 75
+)
+
+// managedDirectives are the redis.conf directives set by the operator, which cannot be overridden through spec.config
+var managedDirectives = map[string]bool{
+	"port": true, "bind": true, "dir": true, "daemonize": true, "pidfile": true, "include": true,
+	"unixsocket": true, "requirepass": true, "masterauth": true, "masteruser": true, "aclfile": true,
+	"replicaof": true, "slaveof": true, "replica-announce-ip": true, "rename-command": true,
+	"cluster-enabled": true, "cluster-config-file": true, "cluster-node-timeout": true, "cluster-announce-ip": true,
+}
+
+// supportedDirectives are the redis.conf directives that can be set through spec.config
+var supportedDirectives = map[string]bool{
+	// General
+	"timeout": true, "tcp-keepalive": true, "tcp-backlog": true, "databases": true, "loglevel": true,
+	"logfile": true, "syslog-enabled": true, "syslog-ident": true, "always-show-logo": true,
+	"set-proc-title": true, "proc-title-template": true, "locale-collate": true, "protected-mode": true,
+	"maxclients": true, "io-threads": true, "io-threads-do-reads": true, "hz": true, "dynamic-hz": true,
+	"oom-score-adj": true, "oom-score-adj-values": true, "disable-thp": true, "jemalloc-bg-thread": true,
+	"acllog-max-len": true, "notify-keyspace-events": true, "tracking-table-max-keys": true,
+	// Snapshotting
+	"save": true, "stop-writes-on-bgsave-error": true, "rdbcompression": true, "rdbchecksum": true,
+	"dbfilename": true, "rdb-del-sync-files": true, "sanitize-dump-payload": true, "rdb-save-incremental-fsync": true,
+	// Append only file
+	"appendonly": true, "appendfilename": true, "appenddirname": true, "appendfsync": true,
+	"no-appendfsync-on-rewrite": true, "auto-aof-rewrite-percentage": true, "auto-aof-rewrite-min-size": true,
+	"aof-load-truncated": true, "aof-use-rdb-preamble": true, "aof-timestamp-enabled": true,
+	"aof-rewrite-incremental-fsync": true,
+	// Replication
+	"replica-serve-stale-data": true, "replica-read-only": true, "repl-diskless-sync": true,
+	"repl-diskless-sync-delay": true, "repl-diskless-sync-max-replicas": true, "repl-diskless-load": true,
+	"repl-ping-replica-period": true, "repl-timeout": true, "repl-disable-tcp-nodelay": true,
+	"repl-backlog-size": true, "repl-backlog-ttl": true, "replica-priority": true, "replica-lazy-flush": true,
+	"min-replicas-to-write": true, "min-replicas-max-lag": true, "replica-ignore-maxmemory": true,
+	// Memory management
+	"maxmemory": true, "maxmemory-policy": true, "maxmemory-samples": true, "maxmemory-eviction-tenacity": true,
+	"maxmemory-clients": true, "active-expire-effort": true, "lfu-log-factor": true, "lfu-decay-time": true,
+	"lazyfree-lazy-eviction": true, "lazyfree-lazy-expire": true, "lazyfree-lazy-server-del": true,
+	"lazyfree-lazy-user-del": true, "lazyfree-lazy-user-flush": true,
+	"activedefrag": true, "active-defrag-ignore-bytes": true, "active-defrag-threshold-lower": true,
+	"active-defrag-threshold-upper": true, "active-defrag-cycle-min": true, "active-defrag-cycle-max": true,
+	"active-defrag-max-scan-fields": true, "activerehashing": true,
+	// Shutdown and scripting
+	"shutdown-timeout": true, "shutdown-on-sigint": true, "shutdown-on-sigterm": true,
+	"lua-time-limit": true, "busy-reply-threshold": true,
+	// Cluster
+	"cluster-replica-validity-factor": true, "cluster-migration-barrier": true,
+	"cluster-allow-replica-migration": true, "cluster-require-full-coverage": true,
+	"cluster-replica-no-failover": true, "cluster-allow-reads-when-down": true,
+	"cluster-allow-pubsubshard-when-down": true, "cluster-link-sendbuf-limit": true,
+	// Monitoring
+	"slowlog-log-slower-than": true, "slowlog-max-len": true, "latency-monitor-threshold": true,
+	"latency-tracking": true, "latency-tracking-info-percentiles": true,
+	// Data structures and clients
+	"hash-max-listpack-entries": true, "hash-max-listpack-value": true, "hash-max-ziplist-entries": true,
+	"hash-max-ziplist-value": true, "list-max-listpack-size": true, "list-max-ziplist-size": true,
+	"list-compress-depth": true, "set-max-intset-entries": true, "set-max-listpack-entries": true,
+	"set-max-listpack-value": true, "zset-max-listpack-entries": true, "zset-max-listpack-value": true,
+	"zset-max-ziplist-entries": true, "zset-max-ziplist-value": true, "hll-sparse-max-bytes": true,
+	"stream-node-max-bytes": true, "stream-node-max-entries": true, "client-output-buffer-limit": true,
+	"client-query-buffer-limit": true, "proto-max-bulk-len": true,
+}
+
+// configMapName returns the name of the ConfigMap holding the rendered spec.config
+func configMapName(redis *cachev1alpha1.Redis) string {
+	return redis.Name + "-config"
+}
+
+// validateRedisConfig checks that every directive of spec.config is a supported redis.conf
+// directive that is not managed by the operator, and that no value spans several lines
+func validateRedisConfig(config map[string]string) error {
+	problems := []string{}
+	for _, directive := range sortedKeys(config) {
+		switch {
+		case managedDirectives[directive] || strings.HasPrefix(directive, "tls-"):
+			problems = append(problems, fmt.Sprintf("%s is managed by the operator", directive))
+		case !supportedDirectives[directive]:
+			problems = append(problems, fmt.Sprintf("%s is not a supported directive", directive))
+		case strings.ContainsAny(config[directive], "\r\n"):
+			problems = append(problems, fmt.Sprintf("%s must be a single line", directive))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// redisConfig returns the directives of spec.config together with the directives derived
+// from the rest of the spec, which spec.config takes precedence over. The TLS directives
+// are managed by the operator and cannot be set through spec.config.
+func redisConfig(redis *cachev1alpha1.Redis) map[string]string {
+	config := persistenceConfig(redis)
+	if maxMemory, found := maxMemoryForRedis(redis); found {
+		config["maxmemory"] = strconv.FormatInt(maxMemory, 10)
+	}
+	for directive, value := range redis.Spec.Config {
+		config[directive] = value
+	}
+	for directive, value := range tlsDirectives(redis) {
+		config[directive] = value
+	}
+	return config
+}
+
+// maxMemoryForRedis returns maxmemory in bytes as resources.maxMemoryPercent of the memory
+// limit, leaving headroom for forks during background saves. It reports false when the
+// container has no valid memory limit.
+func maxMemoryForRedis(redis *cachev1alpha1.Redis) (int64, bool) {
+	limit, err := resource.ParseQuantity(redis.Spec.Resources.Limits.Memory)
+	if err != nil || limit.Value() <= 0 {
+		return 0, false
+	}
+	percent := int64(redis.Spec.Resources.MaxMemoryPercent)
+	if percent <= 0 {
+		percent = defaultMaxMemoryPercent
+	}
+	return limit.Value() * percent / 100, true
+}
+
+// renderRedisConfig renders the Redis configuration as redis.conf
+func renderRedisConfig(redis *cachev1alpha1.Redis) string {
+	return renderDirectives(redisConfig(redis))
+}
+
+// renderDirectives renders the directives in redis.conf format, one per line in alphabetical
+// order. Empty values are rendered as an empty quoted string, as in save "".
+func renderDirectives(directives map[string]string) string {
+	var conf strings.Builder
+	for _, directive := range sortedKeys(directives) {
+		value := directives[directive]
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(&conf, "%s %s\n", directive, value)
+	}
+	return conf.String()
+}
+
+// configHash returns the hash of the directives that need a restart to take effect, so that it
+// changes whenever the pods need to restart. Runtime directives are applied live instead.
+func configHash(redis *cachev1alpha1.Redis) string {
+	return directivesHash(restartDirectives(redis))
+}
+
+// directivesHash returns the hash of the rendered directives
+func directivesHash(directives map[string]string) string {
+	sum := sha256.Sum256([]byte(renderDirectives(directives)))
+	return hex.EncodeToString(sum[:])
+}
+
+// sortedKeys returns the keys of the map in alphabetical order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configMapForRedis returns the ConfigMap holding the rendered spec.config
+func (r *RedisReconciler) configMapForRedis(redis *cachev1alpha1.Redis) (*corev1.ConfigMap, error) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName(redis),
+			Namespace: redis.Namespace,
+			Labels:    labelsForRedis(redis),
+		},
+		Data: map[string]string{
+			redisConfigFile: renderRedisConfig(redis),
+		},
+	}
+	if err := controllerutil.SetControllerReference(redis, configMap, r.Scheme); err != nil {
+		return nil, err
+	}
+	return configMap, nil
+}
+
+// reconcileConfigMap creates the ConfigMap holding the rendered spec.config and keeps it up to date
+func (r *RedisReconciler) reconcileConfigMap(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	logger := log.FromContext(ctx)
+
+	desired, err := r.configMapForRedis(redis)
+	if err != nil {
+		return err
+	}
+
+	foundConfigMap := &corev1.ConfigMap{}
+	err = r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, foundConfigMap)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new ConfigMap", "ConfigMap.Namespace", desired.Namespace, "ConfigMap.Name", desired.Name)
+		if err := r.Create(ctx, desired); err != nil {
+			logger.Error(err, "Failed to create new ConfigMap", "ConfigMap.Namespace", desired.Namespace, "ConfigMap.Name", desired.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get ConfigMap")
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(foundConfigMap.Data, desired.Data) {
+		return nil
+	}
+	foundConfigMap.Data = desired.Data
+	if err := r.Update(ctx, foundConfigMap); err != nil {
+		logger.Error(err, "Failed to update ConfigMap", "ConfigMap.Namespace", foundConfigMap.Namespace, "ConfigMap.Name", foundConfigMap.Name)
+		return err
+	}
+	logger.Info("Updated ConfigMap", "ConfigMap.Namespace", foundConfigMap.Namespace, "ConfigMap.Name", foundConfigMap.Name)
+	return nil
+}
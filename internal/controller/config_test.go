@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestValidateRedisConfig tests that only supported directives are accepted
+func TestValidateRedisConfig(t *testing.T) {
+	err := validateRedisConfig(map[string]string{
+		"maxmemory-policy": "allkeys-lru",
+		"save":             "3600 1 300 100",
+		"appendonly":       "yes",
+	})
+	assert.NoError(t, err, "Supported directives should be accepted")
+
+	err = validateRedisConfig(map[string]string{"requirepass": "secret"})
+	assert.ErrorContains(t, err, "requirepass is managed by the operator", "Managed directives should be rejected")
+
+	err = validateRedisConfig(map[string]string{"maxmemory-polcy": "allkeys-lru"})
+	assert.ErrorContains(t, err, "maxmemory-polcy is not a supported directive", "Unknown directives should be rejected")
+
+	err = validateRedisConfig(map[string]string{"timeout": "0\nrequirepass \"\""})
+	assert.ErrorContains(t, err, "timeout must be a single line", "Values should not inject directives")
+}
+
+// TestConfigMapForRedis tests that spec.config is rendered as redis.conf
+func TestConfigMapForRedis(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			Config: map[string]string{
+				"timeout":          "300",
+				"maxmemory-policy": "allkeys-lru",
+			},
+		},
+	}
+	r := newTestReconciler(t)
+
+	// Act
+	configMap, err := r.configMapForRedis(redis)
+
+	// Assert
+	assert.NoError(t, err, "configMapForRedis should not return an error")
+	assert.Equal(t, "test-redis-config", configMap.Name, "ConfigMap name should be derived from the Redis name")
+	assert.Equal(t, "maxmemory-policy allkeys-lru\ntimeout 300\n", configMap.Data["redis.conf"], "Directives should be rendered in alphabetical order")
+	assert.Len(t, configMap.OwnerReferences, 1, "ConfigMap should be owned by the Redis instance")
+}
+
+// TestConfigHash tests that the pods are rolled when a directive needing a restart changes
+func TestConfigHash(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		Spec: cachev1alpha1.RedisSpec{
+			Config: map[string]string{"databases": "16", "timeout": "300"},
+		},
+	}
+	hash := configHash(redis)
+
+	assert.Equal(t, hash, configHash(redis.DeepCopy()), "Hash should be stable")
+
+	redis.Spec.Config["timeout"] = "600"
+	assert.Equal(t, hash, configHash(redis), "Runtime directives should not roll the pods")
+
+	redis.Spec.Config["databases"] = "32"
+	assert.NotEqual(t, hash, configHash(redis), "Hash should change with directives needing a restart")
+	assert.Equal(t, configHash(redis), podAnnotationsForRedis(redis)["cache.tc/config-hash"], "Pod template should carry the hash")
+}
+
+// TestMaxMemoryForRedis tests that maxmemory is derived from the memory limit
+func TestMaxMemoryForRedis(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		Spec: cachev1alpha1.RedisSpec{
+			Resources: cachev1alpha1.RedisResources{
+				Limits: cachev1alpha1.Limits{Memory: "1Gi"},
+			},
+		},
+	}
+
+	assert.Equal(t, "805306368", redisConfig(redis)["maxmemory"], "maxmemory should default to 75% of the memory limit")
+
+	redis.Spec.Resources.MaxMemoryPercent = 50
+	assert.Equal(t, "536870912", redisConfig(redis)["maxmemory"], "maxmemory should follow maxMemoryPercent")
+
+	redis.Spec.Config = map[string]string{"maxmemory": "100mb"}
+	assert.Equal(t, "100mb", redisConfig(redis)["maxmemory"], "spec.config should take precedence")
+
+	redis.Spec.Config = nil
+	redis.Spec.Resources.Limits.Memory = ""
+	assert.NotContains(t, redisConfig(redis), "maxmemory", "maxmemory should not be set without a memory limit")
+}
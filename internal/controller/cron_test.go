@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseCronSchedule tests that invalid schedules are rejected
+func TestParseCronSchedule(t *testing.T) {
+	for _, spec := range []string{"0 3 * * *", "*/15 * * * *", "0 0 1-15/2 JAN,jul mon-fri", "@daily", "5/10 * * * 7"} {
+		_, err := parseCronSchedule(spec)
+		assert.NoError(t, err, "Schedule %q should be valid", spec)
+	}
+	for _, spec := range []string{"", "0 3 * *", "60 * * * *", "0 0 * * 8", "5-1 * * * *", "*/0 * * * *", "@every 5m"} {
+		_, err := parseCronSchedule(spec)
+		assert.Error(t, err, "Schedule %q should be invalid", spec)
+	}
+}
+
+// TestCronScheduleNext tests the next activation of cron schedules
+func TestCronScheduleNext(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 22, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"0 3 * * *", time.Date(2024, time.February, 1, 3, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2024, time.January, 31, 22, 40, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.January, 31, 23, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Saturday 3 February comes before the 15th when both day fields are restricted
+		{"0 12 15 * sat", time.Date(2024, time.February, 3, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		schedule, err := parseCronSchedule(test.spec)
+		assert.NoError(t, err, "Schedule %q should be valid", test.spec)
+		assert.Equal(t, test.expected, schedule.next(start), "Next activation of %q should match", test.spec)
+	}
+
+	never, err := parseCronSchedule("0 0 30 2 *")
+	assert.NoError(t, err, "Schedule should be valid")
+	assert.True(t, never.next(start).IsZero(), "A schedule that never fires should have no next activation")
+}
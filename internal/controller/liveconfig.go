@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// runtimeDirectiveDefaults are the directives of spec.config that Redis accepts through
+// CONFIG SET, with the default value they are reset to once removed from spec.config
+var runtimeDirectiveDefaults = map[string]string{
+	// General
+	"timeout": "0", "tcp-keepalive": "300", "loglevel": "notice", "maxclients": "10000", "hz": "10",
+	"dynamic-hz": "yes", "notify-keyspace-events": "", "acllog-max-len": "128",
+	// Persistence
+	"save": "3600 1 300 100 60 10000", "stop-writes-on-bgsave-error": "yes", "rdbcompression": "yes",
+	"rdbchecksum": "yes", "appendonly": "no", "appendfsync": "everysec", "no-appendfsync-on-rewrite": "no",
+	"auto-aof-rewrite-percentage": "100", "auto-aof-rewrite-min-size": "64mb",
+	// Replication
+	"replica-serve-stale-data": "yes", "replica-read-only": "yes", "repl-diskless-sync": "yes",
+	"repl-diskless-sync-delay": "5", "repl-ping-replica-period": "10", "repl-timeout": "60",
+	"repl-backlog-size": "1mb", "repl-backlog-ttl": "3600", "replica-priority": "100",
+	"min-replicas-to-write": "0", "min-replicas-max-lag": "10",
+	// Memory management
+	"maxmemory": "0", "maxmemory-policy": "noeviction", "maxmemory-samples": "5",
+	"maxmemory-eviction-tenacity": "10", "lfu-log-factor": "10", "lfu-decay-time": "1",
+	"lazyfree-lazy-eviction": "no", "lazyfree-lazy-expire": "no", "lazyfree-lazy-server-del": "no",
+	"lazyfree-lazy-user-del": "no", "lazyfree-lazy-user-flush": "no", "activedefrag": "no", "activerehashing": "yes",
+	// Scripting, cluster and monitoring
+	"busy-reply-threshold": "5000", "cluster-require-full-coverage": "yes", "cluster-allow-reads-when-down": "no",
+	"cluster-migration-barrier": "1", "cluster-replica-validity-factor": "10",
+	"slowlog-log-slower-than": "10000", "slowlog-max-len": "128", "latency-monitor-threshold": "0",
+	// Data structures and clients
+	"client-output-buffer-limit": "normal 0 0 0 slave 268435456 67108864 60 pubsub 33554432 8388608 60",
+	"client-query-buffer-limit":  "1gb", "proto-max-bulk-len": "512mb",
+	"hash-max-listpack-entries": "128", "hash-max-listpack-value": "64", "list-max-listpack-size": "-2",
+	"list-compress-depth": "0", "set-max-intset-entries": "512", "set-max-listpack-entries": "128",
+	"set-max-listpack-value": "64", "zset-max-listpack-entries": "128", "zset-max-listpack-value": "64",
+	"hll-sparse-max-bytes": "3000", "stream-node-max-bytes": "4096", "stream-node-max-entries": "100",
+}
+
+// runtimeDirectives returns the directives of the Redis configuration that can be applied live
+func runtimeDirectives(redis *cachev1alpha1.Redis) map[string]string {
+	directives := map[string]string{}
+	for directive, value := range redisConfig(redis) {
+		if _, runtime := runtimeDirectiveDefaults[directive]; runtime {
+			directives[directive] = value
+		}
+	}
+	return directives
+}
+
+// restartDirectives returns the directives of the Redis configuration that only take effect when Redis restarts
+func restartDirectives(redis *cachev1alpha1.Redis) map[string]string {
+	directives := map[string]string{}
+	for directive, value := range redisConfig(redis) {
+		if _, runtime := runtimeDirectiveDefaults[directive]; !runtime {
+			directives[directive] = value
+		}
+	}
+	return directives
+}
+
+// liveConfigChanges returns the directives to set with CONFIG SET: the runtime directives of the
+// configuration, and the previously applied directives removed from spec.config since, which
+// are reset to their default
+func liveConfigChanges(live map[string]string, applied []string) map[string]string {
+	desired := map[string]string{}
+	for directive, value := range live {
+		desired[directive] = value
+	}
+	for _, directive := range applied {
+		if _, found := desired[directive]; !found {
+			desired[directive] = runtimeDirectiveDefaults[directive]
+		}
+	}
+	return desired
+}
+
+// applyLiveConfig applies the runtime directives of the configuration to every running Redis server
+// with CONFIG SET, so that changing them does not restart the pods. Directives removed from
+// spec.config since they were last applied are reset to their default. The ConfigMap holds
+// the same directives, so restarted pods keep them without CONFIG REWRITE. Which directives
+// were applied live and which need a restart is recorded in status.config.
+func (r *RedisReconciler) applyLiveConfig(ctx context.Context, redis *cachev1alpha1.Redis, password string) error {
+	logger := log.FromContext(ctx)
+
+	status := redis.Status.Config
+	if status == nil {
+		status = &cachev1alpha1.RedisConfigStatus{}
+		redis.Status.Config = status
+	}
+	status.RestartDirectives = sortedKeys(restartDirectives(redis))
+
+	live := runtimeDirectives(redis)
+	desired := liveConfigChanges(live, status.LiveDirectives)
+	if directivesHash(desired) == status.LiveConfigHash {
+		return nil
+	}
+
+	pods, err := listRedisPods(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+	for i := range pods {
+		rdb, err := connectRedisPod(ctx, &pods[i], tlsConfig, password)
+		if err != nil {
+			return fmt.Errorf("connect to %s: %w", pods[i].Name, err)
+		}
+		for _, directive := range sortedKeys(desired) {
+			if err = rdb.ConfigSet(ctx, directive, desired[directive]).Err(); err != nil {
+				err = fmt.Errorf("set %s on %s: %w", directive, pods[i].Name, err)
+				break
+			}
+		}
+		rdb.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Applied Redis config live", "Directives", sortedKeys(desired), "Pods", len(pods))
+	status.LiveDirectives = sortedKeys(live)
+	status.LiveConfigHash = directivesHash(live)
+	return nil
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestRuntimeDirectives tests that spec.config is split into live and restart directives
+func TestRuntimeDirectives(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		Spec: cachev1alpha1.RedisSpec{
+			Config: map[string]string{
+				"maxmemory-policy": "allkeys-lru",
+				"databases":        "32",
+			},
+		},
+	}
+
+	assert.Equal(t, map[string]string{"maxmemory-policy": "allkeys-lru"}, runtimeDirectives(redis), "Eviction policy should be applied live")
+	assert.Equal(t, map[string]string{"databases": "32"}, restartDirectives(redis), "Database count should need a restart")
+}
+
+// TestApplyLiveConfig tests that the applied directives are recorded in the status
+func TestApplyLiveConfig(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			Config: map[string]string{
+				"maxmemory-policy":        "allkeys-lru",
+				"slowlog-log-slower-than": "5000",
+				"databases":               "32",
+			},
+		},
+	}
+	r := newFakeReconciler(t, redis)
+
+	// Act
+	err := r.applyLiveConfig(context.Background(), redis, "password")
+
+	// Assert
+	assert.NoError(t, err, "applyLiveConfig should not return an error")
+	assert.Equal(t, []string{"maxmemory-policy", "slowlog-log-slower-than"}, redis.Status.Config.LiveDirectives, "Runtime directives should be applied live")
+	assert.Equal(t, []string{"databases"}, redis.Status.Config.RestartDirectives, "Other directives should need a restart")
+	assert.Equal(t, directivesHash(runtimeDirectives(redis)), redis.Status.Config.LiveConfigHash, "Applied directives should be recorded")
+
+	// Act
+	delete(redis.Spec.Config, "slowlog-log-slower-than")
+	err = r.applyLiveConfig(context.Background(), redis, "password")
+
+	// Assert
+	assert.NoError(t, err, "applyLiveConfig should not return an error")
+	assert.Equal(t, []string{"maxmemory-policy"}, redis.Status.Config.LiveDirectives, "Removed directive should be reset")
+}
+
+// TestLiveConfigChanges tests that directives removed from spec.config are reset to their default
+func TestLiveConfigChanges(t *testing.T) {
+	// Arrange
+	live := map[string]string{"maxmemory-policy": "allkeys-lru"}
+	applied := []string{"maxmemory-policy", "slowlog-log-slower-than"}
+
+	// Act
+	desired := liveConfigChanges(live, applied)
+
+	// Assert
+	assert.Equal(t, map[string]string{
+		"maxmemory-policy":        "allkeys-lru",
+		"slowlog-log-slower-than": "10000",
+	}, desired, "Removed directive should be reset to its default")
+	assert.Equal(t, live, liveConfigChanges(live, nil), "Only the configured directives should be set initially")
+}
+
+// TestApplyLiveConfigUnchanged tests that the running servers are not contacted when the applied config is unchanged
+func TestApplyLiveConfigUnchanged(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"},
+		Spec:       cachev1alpha1.RedisSpec{Config: map[string]string{"maxmemory-policy": "allkeys-lru"}},
+	}
+	redis.Status.Config = &cachev1alpha1.RedisConfigStatus{
+		LiveDirectives: []string{"maxmemory-policy"},
+		LiveConfigHash: directivesHash(runtimeDirectives(redis)),
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis-0", Namespace: "default", Labels: labelsForRedis(redis)},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "127.0.0.1"},
+	}
+	r := newFakeReconciler(t, redis, pod)
+	// A cancelled context fails any connection to the running pod
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	err := r.applyLiveConfig(ctx, redis, "password")
+	redis.Spec.Config["maxmemory-policy"] = "volatile-lru"
+	changedErr := r.applyLiveConfig(ctx, redis, "password")
+
+	// Assert
+	assert.NoError(t, err, "Unchanged config should not be applied again")
+	assert.Error(t, changedErr, "Changed config should be set on the running pods")
+	assert.Equal(t, []string{"maxmemory-policy"}, redis.Status.Config.LiveDirectives)
+	assert.NotEqual(t, directivesHash(runtimeDirectives(redis)), redis.Status.Config.LiveConfigHash, "Failed change should not be recorded")
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// metricsPortName is the name of the port metrics are scraped from, e.g. of an exporter sidecar
+	metricsPortName = "metrics"
+	// operatorPodLabel and operatorPodLabelValue label the pods of the operator
+	operatorPodLabel      = "control-plane"
+	operatorPodLabelValue = "controller-manager"
+	// namespaceNameLabel is the label every namespace carries with its name
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+// clientPortNames are the named ports clients connect to. Named ports that a pod does not
+// expose, such as the TLS ports without TLS, do not match.
+var clientPortNames = []string{"redis", "redis-tls", "sentinel", "sentinel-tls"}
+
+// memberSelector selects the Redis and Sentinel pods of the instance
+func memberSelector(redis *cachev1alpha1.Redis) metav1.LabelSelector {
+	return metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      "app",
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   []string{redis.Name, sentinelName(redis)},
+		}},
+	}
+}
+
+// namedPorts returns the NetworkPolicy ports matching the container ports of the given names.
+// The protocol is set as the API server defaults it, so that the policy compares equal.
+func namedPorts(names ...string) []networkingv1.NetworkPolicyPort {
+	ports := []networkingv1.NetworkPolicyPort{}
+	for _, name := range names {
+		port := intstr.FromString(name)
+		protocol := corev1.ProtocolTCP
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+	return ports
+}
+
+// networkPolicyError reports a NetworkPolicy that cannot be generated, with the reason of the
+// NetworkPolicyReady condition
+type networkPolicyError struct {
+	reason  string
+	message string
+}
+
+func (e *networkPolicyError) Error() string {
+	return e.message
+}
+
+// operatorPeer returns the peer matching the operator pods in their namespace, which connect
+// to every pod to manage replication, the cluster and passwords
+func operatorPeer(operatorNamespace string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: operatorNamespace}},
+		PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{operatorPodLabel: operatorPodLabelValue}},
+	}
+}
+
+// networkPolicyForRedis returns the NetworkPolicy of the Redis and Sentinel pods. Members
+// reach each other on every port for replication, Sentinel and the cluster bus, the operator
+// and the clients of spec.networkPolicy reach the client ports, and the metrics port can be
+// scraped from spec.networkPolicy.metricsNamespaceSelector. Without a known operator namespace
+// no policy is generated, since admitting the operator pods from every namespace would admit
+// any pod carrying their label.
+func (r *RedisReconciler) networkPolicyForRedis(redis *cachev1alpha1.Redis) (*networkingv1.NetworkPolicy, error) {
+	if r.OperatorNamespace == "" {
+		return nil, &networkPolicyError{
+			reason:  "OperatorNamespaceUnknown",
+			message: "The NetworkPolicy cannot admit the operator because POD_NAMESPACE is not set on the operator",
+		}
+	}
+	spec := redis.Spec.NetworkPolicy
+	members := memberSelector(redis)
+
+	clients := []networkingv1.NetworkPolicyPeer{operatorPeer(r.OperatorNamespace)}
+	for i := range spec.NamespaceSelectors {
+		clients = append(clients, networkingv1.NetworkPolicyPeer{NamespaceSelector: &spec.NamespaceSelectors[i]})
+	}
+	for i := range spec.PodSelectors {
+		clients = append(clients, networkingv1.NetworkPolicyPeer{PodSelector: &spec.PodSelectors[i]})
+	}
+	for _, cidr := range spec.CIDRs {
+		clients = append(clients, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: string(cidr)}})
+	}
+
+	metricsNamespaces := spec.MetricsNamespaceSelector
+	if metricsNamespaces == nil {
+		metricsNamespaces = &metav1.LabelSelector{}
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redis.Name,
+			Namespace: redis.Namespace,
+			Labels:    labelsForRedis(redis),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: members,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &members}}},
+				{From: clients, Ports: namedPorts(clientPortNames...)},
+				{From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: metricsNamespaces}}, Ports: namedPorts(metricsPortName)},
+			},
+		},
+	}
+	if err := controllerutil.SetControllerReference(redis, policy, r.Scheme); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// reconcileNetworkPolicy creates the NetworkPolicy and keeps its rules in line with
+// spec.networkPolicy, and deletes it once spec.networkPolicy is removed. A policy that cannot
+// be generated is reported as a networkPolicyError.
+func (r *RedisReconciler) reconcileNetworkPolicy(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	logger := log.FromContext(ctx)
+
+	foundPolicy := &networkingv1.NetworkPolicy{}
+	err := r.Get(ctx, types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace}, foundPolicy)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get NetworkPolicy")
+		return err
+	}
+	found := err == nil
+
+	if redis.Spec.NetworkPolicy == nil {
+		meta.RemoveStatusCondition(&redis.Status.Conditions, typeNetworkPolicyReadyRedis)
+		if !found || !metav1.IsControlledBy(foundPolicy, redis) {
+			return nil
+		}
+		if err := r.Delete(ctx, foundPolicy); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete NetworkPolicy", "NetworkPolicy.Namespace", foundPolicy.Namespace, "NetworkPolicy.Name", foundPolicy.Name)
+			return err
+		}
+		logger.Info("Deleted NetworkPolicy", "NetworkPolicy.Namespace", foundPolicy.Namespace, "NetworkPolicy.Name", foundPolicy.Name)
+		return nil
+	}
+
+	desired, err := r.networkPolicyForRedis(redis)
+	if err != nil {
+		return err
+	}
+	if !found {
+		logger.Info("Creating a new NetworkPolicy", "NetworkPolicy.Namespace", desired.Namespace, "NetworkPolicy.Name", desired.Name)
+		if err := r.Create(ctx, desired); err != nil {
+			logger.Error(err, "Failed to create new NetworkPolicy", "NetworkPolicy.Namespace", desired.Namespace, "NetworkPolicy.Name", desired.Name)
+			return err
+		}
+	} else if !equality.Semantic.DeepEqual(foundPolicy.Spec, desired.Spec) {
+		foundPolicy.Spec = desired.Spec
+		if err := r.Update(ctx, foundPolicy); err != nil {
+			logger.Error(err, "Failed to update NetworkPolicy", "NetworkPolicy.Namespace", foundPolicy.Namespace, "NetworkPolicy.Name", foundPolicy.Name)
+			return err
+		}
+		logger.Info("Updated NetworkPolicy", "NetworkPolicy.Namespace", foundPolicy.Namespace, "NetworkPolicy.Name", foundPolicy.Name)
+	}
+
+	meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+		Type:               typeNetworkPolicyReadyRedis,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Applied",
+		Message:            fmt.Sprintf("Clients are admitted by NetworkPolicy %s", desired.Name),
+		ObservedGeneration: redis.Generation,
+	})
+	return nil
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newTestNetworkPolicy returns a spec.networkPolicy admitting clients from a namespace and an IP block
+func newTestNetworkPolicy() *cachev1alpha1.RedisNetworkPolicy {
+	return &cachev1alpha1.RedisNetworkPolicy{
+		NamespaceSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"team": "analytics"}}},
+		CIDRs:              []cachev1alpha1.RedisCIDR{"10.0.0.0/8"},
+	}
+}
+
+// TestNetworkPolicyForRedis tests that members, the operator, the allowed clients and metrics scrapers are admitted
+func TestNetworkPolicyForRedis(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.NetworkPolicy = newTestNetworkPolicy()
+	r := newTestReconciler(t)
+	r.OperatorNamespace = "redis-operator-system"
+
+	// Act
+	policy, err := r.networkPolicyForRedis(redis)
+
+	// Assert
+	assert.NoError(t, err, "networkPolicyForRedis should not return an error")
+	assert.Equal(t, []string{"test-redis", "test-redis-sentinel"}, policy.Spec.PodSelector.MatchExpressions[0].Values, "Redis and Sentinel pods should be selected")
+	assert.Len(t, policy.Spec.Ingress, 3, "Members, clients and metrics should have a rule each")
+
+	members := policy.Spec.Ingress[0]
+	assert.Empty(t, members.Ports, "Members should reach each other on every port")
+	assert.Equal(t, policy.Spec.PodSelector, *members.From[0].PodSelector, "Members should be admitted")
+
+	clients := policy.Spec.Ingress[1]
+	assert.Len(t, clients.From, 3, "Operator, namespace and IP block should be admitted")
+	assert.Equal(t, "redis-operator-system", clients.From[0].NamespaceSelector.MatchLabels[namespaceNameLabel], "Operator should only be admitted from its namespace")
+	assert.Equal(t, "analytics", clients.From[1].NamespaceSelector.MatchLabels["team"], "Allowed namespaces should be admitted")
+	assert.Equal(t, "10.0.0.0/8", clients.From[2].IPBlock.CIDR, "Allowed IP blocks should be admitted")
+	assert.Equal(t, "redis", clients.Ports[0].Port.StrVal, "Clients should only reach the client ports")
+
+	metrics := policy.Spec.Ingress[2]
+	assert.Equal(t, "metrics", metrics.Ports[0].Port.StrVal, "Metrics port should be scrapable")
+	assert.Empty(t, metrics.From[0].NamespaceSelector.MatchLabels, "Metrics should be scrapable from every namespace by default")
+}
+
+// TestReconcileNetworkPolicy tests that the NetworkPolicy follows spec.networkPolicy and is deleted once it is removed
+func TestReconcileNetworkPolicy(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.NetworkPolicy = newTestNetworkPolicy()
+	r := newFakeReconciler(t, redis)
+	r.OperatorNamespace = "redis-operator-system"
+	key := types.NamespacedName{Name: "test-redis", Namespace: "default"}
+
+	// Act
+	createErr := r.reconcileNetworkPolicy(context.Background(), redis)
+	redis.Spec.NetworkPolicy.CIDRs = nil
+	updateErr := r.reconcileNetworkPolicy(context.Background(), redis)
+	updated := &networkingv1.NetworkPolicy{}
+	getErr := r.Get(context.Background(), key, updated)
+	applied := meta.IsStatusConditionTrue(redis.Status.Conditions, typeNetworkPolicyReadyRedis)
+	redis.Spec.NetworkPolicy = nil
+	deleteErr := r.reconcileNetworkPolicy(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, createErr, "reconcileNetworkPolicy should create the NetworkPolicy")
+	assert.NoError(t, updateErr, "reconcileNetworkPolicy should update the NetworkPolicy")
+	assert.NoError(t, getErr)
+	assert.Len(t, updated.Spec.Ingress[1].From, 2, "Removed IP blocks should no longer be admitted")
+	assert.True(t, applied, "NetworkPolicyReady should be true")
+	assert.NoError(t, deleteErr, "reconcileNetworkPolicy should delete the NetworkPolicy")
+	err := r.Get(context.Background(), key, &networkingv1.NetworkPolicy{})
+	assert.True(t, errors.IsNotFound(err), "NetworkPolicy should be deleted once spec.networkPolicy is removed")
+	assert.Nil(t, meta.FindStatusCondition(redis.Status.Conditions, typeNetworkPolicyReadyRedis), "NetworkPolicyReady should be removed with spec.networkPolicy")
+}
+
+// TestReconcileNetworkPolicyOperatorNamespaceUnknown tests that no NetworkPolicy is generated without the operator namespace
+func TestReconcileNetworkPolicyOperatorNamespaceUnknown(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.NetworkPolicy = newTestNetworkPolicy()
+	r := newFakeReconciler(t, redis)
+
+	// Act
+	err := r.reconcileNetworkPolicy(context.Background(), redis)
+
+	// Assert
+	var policyErr *networkPolicyError
+	assert.ErrorAs(t, err, &policyErr, "Unknown operator namespace should be reported as a networkPolicyError")
+	assert.Equal(t, "OperatorNamespaceUnknown", policyErr.reason, "Unknown operator namespace should be reported")
+	getErr := r.Get(context.Background(), types.NamespacedName{Name: "test-redis", Namespace: "default"}, &networkingv1.NetworkPolicy{})
+	assert.True(t, errors.IsNotFound(getErr), "NetworkPolicy should not admit the operator pods from every namespace")
+}
+
+// TestDeleteDependantResourcesNetworkPolicy tests that deleting the instance only deletes the NetworkPolicy it owns
+func TestDeleteDependantResourcesNetworkPolicy(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.NetworkPolicy = newTestNetworkPolicy()
+	foreign := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"}}
+	r := newFakeReconciler(t, redis, foreign)
+	key := types.NamespacedName{Name: "test-redis", Namespace: "default"}
+
+	// Act
+	foreignErr := r.deleteDependantResources(context.Background(), redis)
+	foreignGetErr := r.Get(context.Background(), key, &networkingv1.NetworkPolicy{})
+	assert.NoError(t, r.Delete(context.Background(), foreign))
+	r.OperatorNamespace = "redis-operator-system"
+	assert.NoError(t, r.reconcileNetworkPolicy(context.Background(), redis))
+	ownedErr := r.deleteDependantResources(context.Background(), redis)
+	ownedGetErr := r.Get(context.Background(), key, &networkingv1.NetworkPolicy{})
+
+	// Assert
+	assert.NoError(t, foreignErr, "deleteDependantResources should not return an error")
+	assert.NoError(t, foreignGetErr, "NetworkPolicy not owned by the instance should not be deleted")
+	assert.NoError(t, ownedErr, "deleteDependantResources should not return an error")
+	assert.True(t, errors.IsNotFound(ownedGetErr), "NetworkPolicy owned by the instance should be deleted")
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"strings"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+)
+
+// defaultAppendFsync is the fsync policy of the append only file when spec.persistence does not set one
+const defaultAppendFsync = "everysec"
+
+// persistenceMode returns the persistence mode of the Redis instance, RDB snapshots by default
+func persistenceMode(redis *cachev1alpha1.Redis) cachev1alpha1.RedisPersistenceMode {
+	if redis.Spec.Persistence == nil || redis.Spec.Persistence.Mode == "" {
+		return cachev1alpha1.RedisPersistenceRDB
+	}
+	return redis.Spec.Persistence.Mode
+}
+
+// persistenceEnabled reports whether the Redis pods persist their data on a volume
+func persistenceEnabled(redis *cachev1alpha1.Redis) bool {
+	return persistenceMode(redis) != cachev1alpha1.RedisPersistenceNone
+}
+
+// persistenceConfig returns the redis.conf directives implementing the persistence mode.
+// Directives matching the Redis defaults, which take RDB snapshots without an append only
+// file, are left out.
+func persistenceConfig(redis *cachev1alpha1.Redis) map[string]string {
+	mode := persistenceMode(redis)
+	rdb := mode == cachev1alpha1.RedisPersistenceRDB || mode == cachev1alpha1.RedisPersistenceRDBAOF
+	aof := mode == cachev1alpha1.RedisPersistenceAOF || mode == cachev1alpha1.RedisPersistenceRDBAOF
+
+	config := map[string]string{}
+	if !rdb {
+		config["save"] = ""
+	} else if persistence := redis.Spec.Persistence; persistence != nil && len(persistence.Save) > 0 {
+		config["save"] = strings.Join(persistence.Save, " ")
+	}
+	if aof {
+		config["appendonly"] = "yes"
+		config["appendfsync"] = defaultAppendFsync
+		if persistence := redis.Spec.Persistence; persistence.AppendFsync != "" {
+			config["appendfsync"] = persistence.AppendFsync
+		}
+	}
+	return config
+}
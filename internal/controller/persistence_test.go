@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestPersistenceConfig tests the directives rendered for each persistence mode
+func TestPersistenceConfig(t *testing.T) {
+	redis := &cachev1alpha1.Redis{}
+	assert.Empty(t, persistenceConfig(redis), "RDB snapshots should use the Redis defaults when persistence is not set")
+	assert.True(t, persistenceEnabled(redis), "Persistence should be enabled by default")
+
+	redis.Spec.Persistence = &cachev1alpha1.RedisPersistence{
+		Mode: cachev1alpha1.RedisPersistenceRDB,
+		Save: []string{"900 1", "300 10"},
+	}
+	assert.Equal(t, map[string]string{"save": "900 1 300 10"}, persistenceConfig(redis), "Save schedules should be joined")
+
+	redis.Spec.Persistence = &cachev1alpha1.RedisPersistence{Mode: cachev1alpha1.RedisPersistenceAOF}
+	assert.Equal(t, map[string]string{"save": "", "appendonly": "yes", "appendfsync": "everysec"}, persistenceConfig(redis), "AOF should disable snapshots")
+
+	redis.Spec.Persistence = &cachev1alpha1.RedisPersistence{Mode: cachev1alpha1.RedisPersistenceRDBAOF, AppendFsync: "always"}
+	assert.Equal(t, map[string]string{"appendonly": "yes", "appendfsync": "always"}, persistenceConfig(redis), "RDB and AOF should keep the default snapshots")
+
+	redis.Spec.Persistence = &cachev1alpha1.RedisPersistence{Mode: cachev1alpha1.RedisPersistenceNone}
+	assert.Equal(t, map[string]string{"save": ""}, persistenceConfig(redis), "No persistence should disable snapshots")
+	assert.False(t, persistenceEnabled(redis), "Persistence should be disabled")
+	assert.Equal(t, "save \"\"\n", renderRedisConfig(redis), "Empty save should be rendered quoted")
+}
+
+// TestStatefulSetForRedisWithoutPersistence tests that no volume is claimed without persistence
+func TestStatefulSetForRedisWithoutPersistence(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			Replicas: 1,
+			Image:    "redis",
+			Version:  "7.2",
+			Resources: cachev1alpha1.RedisResources{
+				Requests: cachev1alpha1.Requests{CPU: "100m", Memory: "128Mi"},
+				Limits:   cachev1alpha1.Limits{CPU: "500m", Memory: "256Mi"},
+			},
+			Persistence: &cachev1alpha1.RedisPersistence{Mode: cachev1alpha1.RedisPersistenceNone},
+		},
+	}
+	r := newTestReconciler(t)
+
+	// Act
+	statefulSet, err := r.statefulSetForRedis(redis, "redis-secret")
+
+	// Assert
+	assert.NoError(t, err, "statefulSetForRedis should not return an error without storage")
+	assert.Empty(t, statefulSet.Spec.VolumeClaimTemplates, "No volume should be claimed")
+
+	var dataVolumeFound bool
+	for _, volume := range statefulSet.Spec.Template.Spec.Volumes {
+		if volume.Name == dataVolumeName {
+			dataVolumeFound = true
+			assert.NotNil(t, volume.EmptyDir, "Data directory should be an emptyDir volume")
+		}
+	}
+	assert.True(t, dataVolumeFound, "Data volume should still be mounted")
+}
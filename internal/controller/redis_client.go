@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// redisDialTimeout bounds how long the operator waits when connecting to a Redis pod
+const redisDialTimeout = 5 * time.Second
+
+// newRedisClient returns a client connected to the Redis server running in the given pod.
+// With a TLS configuration it connects to the TLS port and verifies the pod certificate.
+func newRedisClient(pod *corev1.Pod, tlsConfig *tls.Config, password string) *goredis.Client {
+	port := redisPort
+	if tlsConfig != nil {
+		port = redisTLSPort
+	}
+	return goredis.NewClient(&goredis.Options{
+		Addr:        net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)),
+		Password:    password,
+		DialTimeout: redisDialTimeout,
+		MaxRetries:  1,
+		TLSConfig:   tlsConfigForPod(tlsConfig, pod),
+	})
+}
+
+// connectRedisPod returns a client connected to the Redis server running in the given pod,
+// authenticated with the first of the given passwords the server accepts
+func connectRedisPod(ctx context.Context, pod *corev1.Pod, tlsConfig *tls.Config, passwords ...string) (*goredis.Client, error) {
+	var lastErr error
+	for _, password := range passwords {
+		rdb := newRedisClient(pod, tlsConfig, password)
+		err := rdb.Ping(ctx).Err()
+		if err == nil {
+			return rdb, nil
+		}
+		rdb.Close()
+		lastErr = err
+		if !isAuthError(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// isAuthError reports whether the error was returned because the password was rejected
+func isAuthError(err error) bool {
+	message := err.Error()
+	return strings.HasPrefix(message, "WRONGPASS") || strings.HasPrefix(message, "NOAUTH") ||
+		strings.HasPrefix(message, "ERR invalid password")
+}
+
+// listRedisPods returns the running pods of the Redis StatefulSet that have an IP assigned
+func listRedisPods(ctx context.Context, c client.Reader, redis *cachev1alpha1.Redis) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	if err := c.List(ctx, podList, client.InNamespace(redis.Namespace), client.MatchingLabels(labelsForRedis(redis))); err != nil {
+		return nil, err
+	}
+
+	pods := []corev1.Pod{}
+	for _, pod := range podList.Items {
+		if pod.DeletionTimestamp.IsZero() && pod.Status.Phase == corev1.PodRunning && pod.Status.PodIP != "" {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
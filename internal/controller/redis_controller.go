@@ -18,15 +18,20 @@ package controller
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
@@ -36,11 +41,26 @@ import (
 type RedisReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// OperatorNamespace is the namespace the operator runs in, which the NetworkPolicies of
+	// the Redis instances admit the operator from. No NetworkPolicy is generated when empty.
+	OperatorNamespace string
 }
 
 //+kubebuilder:rbac:groups=cache.tc,resources=redis,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=cache.tc,resources=redis/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=cache.tc,resources=redis/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
 
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.3/pkg/reconcile
@@ -48,7 +68,7 @@ type RedisReconciler struct {
 // Reconcile reconciles the state of the Redis instance.
 // It is the main entry point for the Redis controller logic.
 // The function fetches the Redis instance, checks if it is marked for deletion,
-// adds the finalizer if necessary, creates or updates the Secret and Deployment,
+// adds the finalizer if necessary, creates or updates the Secret, ConfigMap, Services and StatefulSet,
 // and handles the cleanup of dependent resources when the Redis instance is being deleted.
 
 const redisFinalizer = "redis.cache.tc/finalizer"
@@ -69,63 +89,320 @@ func (r *RedisReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		logger.Error(err, "Failed to get Redis")
 		return ctrl.Result{}, err
 	}
-	// apply finalizer logic
-	r.reconcileFinalizer(ctx, redis)
+	// apply finalizer logic, and stop once the instance is being deleted
+	result, err := r.reconcileFinalizer(ctx, redis)
+	if err != nil || !redis.DeletionTimestamp.IsZero() {
+		return result, err
+	}
 
-	// Check if the Secret already exists, if not create one
-	secretName := fmt.Sprintf("%s-secret", redis.Name)
+	// Resolve the Secret holding the password, generating it unless the user supplied one
+	secretName, password, err := r.reconcileSecret(ctx, redis)
+	if err != nil {
+		var credentialsErr *credentialsError
+		if !stderrors.As(err, &credentialsErr) {
+			return ctrl.Result{}, err
+		}
+		logger.Info("Redis credentials are not ready", "Reason", credentialsErr.reason, "Message", credentialsErr.message)
+		meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+			Type:               typeCredentialsReadyRedis,
+			Status:             metav1.ConditionFalse,
+			Reason:             credentialsErr.reason,
+			Message:            credentialsErr.message,
+			ObservedGeneration: redis.Generation,
+		})
+		if err := r.Status().Update(ctx, redis); err != nil {
+			logger.Error(err, "Failed to update Redis status")
+			return ctrl.Result{}, err
+		}
+		// The Secret watch triggers a new reconciliation once missing credentials exist,
+		// other failures are retried with a backoff
+		return ctrl.Result{}, credentialsErr.cause
+	}
+	meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+		Type:               typeCredentialsReadyRedis,
+		Status:             metav1.ConditionTrue,
+		Reason:             "SecretFound",
+		Message:            fmt.Sprintf("Redis password is read from Secret %s", secretName),
+		ObservedGeneration: redis.Generation,
+	})
 
-	foundSecret := &corev1.Secret{}
-	err = r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: redis.Namespace}, foundSecret)
-	if err != nil && errors.IsNotFound(err) {
-		// Secret not found, create a new one
-		redisPassword, _ := generateRandomPassword()
-		secret, _ := r.createSecret(redis, redisPassword)
+	// Request or check the TLS certificate before the pods mount it
+	if err := r.reconcileTLS(ctx, redis); err != nil {
+		var tlsErr *tlsError
+		if !stderrors.As(err, &tlsErr) {
+			logger.Error(err, "Failed to reconcile TLS")
+			return ctrl.Result{}, err
+		}
+		logger.Info("Redis TLS certificate is not ready", "Reason", tlsErr.reason, "Message", tlsErr.message)
+		meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+			Type:               typeTLSReadyRedis,
+			Status:             metav1.ConditionFalse,
+			Reason:             tlsErr.reason,
+			Message:            tlsErr.message,
+			ObservedGeneration: redis.Generation,
+		})
+		if err := r.Status().Update(ctx, redis); err != nil {
+			logger.Error(err, "Failed to update Redis status")
+			return ctrl.Result{}, err
+		}
+		// cert-manager may take a while to issue the certificate, which is not watched
+		return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+	}
 
-		logger.Info("Creating a new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
-		err = r.Create(ctx, secret)
-		if err != nil {
-			logger.Error(err, "Failed to create new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+	// Rotate the generated password when due
+	password, rotationRequeue, err := r.reconcilePasswordRotation(ctx, redis, password)
+	if err != nil {
+		logger.Error(err, "Failed to rotate Redis password")
+		return ctrl.Result{}, err
+	}
+
+	// Render spec.config into the ConfigMap mounted as redis.conf, unless it is invalid
+	if err := validateRedisConfig(redis.Spec.Config); err != nil {
+		logger.Info("Redis config is invalid", "Reason", err.Error())
+		meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+			Type:               typeConfigValidRedis,
+			Status:             metav1.ConditionFalse,
+			Reason:             "InvalidConfig",
+			Message:            err.Error(),
+			ObservedGeneration: redis.Generation,
+		})
+		if err := r.Status().Update(ctx, redis); err != nil {
+			logger.Error(err, "Failed to update Redis status")
 			return ctrl.Result{}, err
 		}
+		return ctrl.Result{}, nil
+	}
+	meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+		Type:               typeConfigValidRedis,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Valid",
+		Message:            fmt.Sprintf("Redis config is rendered into ConfigMap %s", configMapName(redis)),
+		ObservedGeneration: redis.Generation,
+	})
+	if err := r.reconcileConfigMap(ctx, redis); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Restrict who can reach the pods before they are created
+	if err := r.reconcileNetworkPolicy(ctx, redis); err != nil {
+		var policyErr *networkPolicyError
+		if !stderrors.As(err, &policyErr) {
+			return ctrl.Result{}, err
+		}
+		logger.Info("Redis NetworkPolicy cannot be applied", "Reason", policyErr.reason, "Message", policyErr.message)
+		meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+			Type:               typeNetworkPolicyReadyRedis,
+			Status:             metav1.ConditionFalse,
+			Reason:             policyErr.reason,
+			Message:            policyErr.message,
+			ObservedGeneration: redis.Generation,
+		})
+		if err := r.Status().Update(ctx, redis); err != nil {
+			logger.Error(err, "Failed to update Redis status")
+			return ctrl.Result{}, err
+		}
+		// The pods are not created unprotected, and the operator namespace only changes with a restart
+		return ctrl.Result{}, nil
+	}
 
+	// Check if the headless Service already exists, if not create one
+	foundHeadlessService := &corev1.Service{}
+	err = r.Get(ctx, types.NamespacedName{Name: headlessServiceName(redis), Namespace: redis.Namespace}, foundHeadlessService)
+	if err != nil && errors.IsNotFound(err) {
+		svc, err := r.headlessServiceForRedis(redis)
+		if err != nil {
+			logger.Error(err, "Failed to define new headless Service")
+			return ctrl.Result{}, err
+		}
+		logger.Info("Creating a new headless Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+		err = r.Create(ctx, svc)
+		if err != nil {
+			logger.Error(err, "Failed to create new headless Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+			return ctrl.Result{}, err
+		}
 	} else if err != nil {
-		logger.Error(err, "Failed to get Secret")
+		logger.Error(err, "Failed to get headless Service")
+		return ctrl.Result{}, err
+	} else if desired, err := r.headlessServiceForRedis(redis); err != nil {
 		return ctrl.Result{}, err
+	} else if updateServiceSpec(foundHeadlessService, desired) {
+		// The ports change when TLS is enabled or the plaintext port is disabled
+		if err := r.Update(ctx, foundHeadlessService); err != nil {
+			logger.Error(err, "Failed to update headless Service", "Service.Namespace", foundHeadlessService.Namespace, "Service.Name", foundHeadlessService.Name)
+			return ctrl.Result{}, err
+		}
+		logger.Info("Updated headless Service", "Service.Namespace", foundHeadlessService.Namespace, "Service.Name", foundHeadlessService.Name)
 	}
 
-	// Check if the Redis Deployment already exists, if not create one
-	foundDeployment := &appsv1.Deployment{}
-	err = r.Get(ctx, types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace}, foundDeployment)
+	// Check if the Redis StatefulSet already exists, if not create one
+	foundStatefulSet := &appsv1.StatefulSet{}
+	err = r.Get(ctx, types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace}, foundStatefulSet)
 	if err != nil && errors.IsNotFound(err) {
-		// Define a new deployment
-		dep, _ := r.deploymentForRedis(redis, secretName)
-		logger.Info("Creating a new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
-		err = r.Create(ctx, dep)
+		// Define a new StatefulSet
+		sts, err := r.statefulSetForRedis(redis, secretName)
 		if err != nil {
-			logger.Error(err, "Failed to create new Deployment", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			logger.Error(err, "Failed to define new StatefulSet")
 			return ctrl.Result{}, err
 		}
-		// Deployment created successfully
+		// Seed the data volume from spec.restoreFrom, unless it was restored before
+		if redis.Spec.RestoreFrom != nil && !meta.IsStatusConditionTrue(redis.Status.Conditions, typeRestoredRedis) {
+			source, err := r.resolveRestoreSource(ctx, redis)
+			if err != nil {
+				var restoreErr *restoreError
+				if !stderrors.As(err, &restoreErr) {
+					return ctrl.Result{}, err
+				}
+				logger.Info("Redis restore source is not ready", "Reason", restoreErr.reason, "Message", restoreErr.message)
+				meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+					Type:               typeRestoredRedis,
+					Status:             metav1.ConditionFalse,
+					Reason:             restoreErr.reason,
+					Message:            restoreErr.message,
+					ObservedGeneration: redis.Generation,
+				})
+				if err := r.Status().Update(ctx, redis); err != nil {
+					logger.Error(err, "Failed to update Redis status")
+					return ctrl.Result{}, err
+				}
+				return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+			}
+			if source.volumeSnapshot != "" {
+				// The provisioned volume already holds the data, so the restore is complete
+				provisioned, err := r.provisionFromVolumeSnapshot(ctx, redis, source.volumeSnapshot)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				condition := metav1.Condition{
+					Type:               typeRestoredRedis,
+					Status:             metav1.ConditionTrue,
+					Reason:             "ProvisionedFromSnapshot",
+					Message:            fmt.Sprintf("The data volume was provisioned from VolumeSnapshot %s", source.volumeSnapshot),
+					ObservedGeneration: redis.Generation,
+				}
+				if !provisioned {
+					condition.Status = metav1.ConditionFalse
+					condition.Reason = "DataVolumeExists"
+					condition.Message = fmt.Sprintf("The data volume of %s already exists and was not restored from VolumeSnapshot %s", podName(redis, 0), source.volumeSnapshot)
+				}
+				meta.SetStatusCondition(&redis.Status.Conditions, condition)
+				if err := r.Status().Update(ctx, redis); err != nil {
+					logger.Error(err, "Failed to update Redis status")
+					return ctrl.Result{}, err
+				}
+			} else if err := addRestoreToStatefulSet(sts, redis, source); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		// Data volume claims retained from a deleted instance of the same name are mounted again
+		if err := r.adoptRetainedDataVolumeClaims(ctx, redis); err != nil {
+			logger.Error(err, "Failed to adopt retained PersistentVolumeClaims")
+			return ctrl.Result{}, err
+		}
+		logger.Info("Creating a new StatefulSet", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		err = r.Create(ctx, sts)
+		if err != nil {
+			logger.Error(err, "Failed to create new StatefulSet", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+			return ctrl.Result{}, err
+		}
+		// StatefulSet created successfully
 		return ctrl.Result{Requeue: true}, nil
 	} else if err != nil {
-		logger.Error(err, "Failed to get Deployment")
+		logger.Error(err, "Failed to get StatefulSet")
 		return ctrl.Result{}, err
 	}
-	// Update deployment if necessary
-	result, err := r.updateDeploymentAndStatus(ctx, redis, foundDeployment)
+
+	// Wait for the data volume to be seeded before scaling out and forming the topology
+	inProgress, err := r.reconcileRestore(ctx, redis, foundStatefulSet)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if inProgress {
+		if err := r.Status().Update(ctx, redis); err != nil {
+			logger.Error(err, "Failed to update Redis status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+	}
+
+	// Expand the data volumes when spec.storage.size grows
+	resizing, err := r.reconcileStorage(ctx, redis)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile storage")
+		return ctrl.Result{}, err
+	}
+
+	// The StatefulSet replaces the Deployment managed by earlier versions of the operator
+	if err := r.deleteLegacyDeployment(ctx, redis); err != nil {
+		logger.Error(err, "Failed to delete legacy Deployment")
+		return ctrl.Result{}, err
+	}
+
+	// Deploy the Sentinel quorum when enabled
+	if err := r.reconcileSentinel(ctx, redis, secretName); err != nil {
+		logger.Error(err, "Failed to reconcile Sentinel")
+		return ctrl.Result{}, err
+	}
+
+	// Point every replica at the primary, or form the cluster in cluster mode
+	var replicationResult ctrl.Result
+	if isClusterMode(redis) {
+		redis.Status.Primary = ""
+		replicationResult, err = r.reconcileCluster(ctx, redis, password)
+	} else {
+		redis.Status.Cluster = nil
+		replicationResult, err = r.reconcileReplication(ctx, redis, password)
+	}
+	if err != nil {
+		return replicationResult, err
+	}
+
+	// Apply runtime-safe configuration changes without restarting the pods
+	if err := r.applyLiveConfig(ctx, redis, password); err != nil {
+		logger.Info("Redis config not applied live yet", "Reason", err.Error())
+		if replicationResult.RequeueAfter == 0 {
+			replicationResult.RequeueAfter = replicationRequeueInterval
+		}
+	}
+
+	// Make sure no Redis server accepts unauthenticated clients
+	if err := r.verifyAuthentication(ctx, redis); err != nil {
+		logger.Error(err, "Failed to verify Redis authentication")
+		return ctrl.Result{}, err
+	}
+
+	// Route clients to the primary
+	if err := r.reconcileService(ctx, redis); err != nil {
+		logger.Error(err, "Failed to reconcile Service")
+		return ctrl.Result{}, err
+	}
+
+	// Update StatefulSet if necessary
+	result, err = r.updateStatefulSetAndStatus(ctx, redis, foundStatefulSet, secretName)
 	if err != nil {
 		return result, err
 	}
 
-	return ctrl.Result{}, nil
+	// Follow the file system resize of expanded volumes
+	if resizing && !replicationResult.Requeue && replicationResult.RequeueAfter == 0 {
+		replicationResult.RequeueAfter = replicationRequeueInterval
+	}
+
+	// Come back for the next step of the password rotation
+	if rotationRequeue > 0 && !replicationResult.Requeue && (replicationResult.RequeueAfter == 0 || rotationRequeue < replicationResult.RequeueAfter) {
+		replicationResult.RequeueAfter = rotationRequeue
+	}
+	return replicationResult, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *RedisReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&cachev1alpha1.Redis{}).
-		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Secret{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.redisForSecret)).
 		Complete(r)
 }
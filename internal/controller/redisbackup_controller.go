@@ -0,0 +1,444 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+)
+
+// RedisBackupReconciler reconciles a RedisBackup object
+type RedisBackupReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=cache.tc,resources=redisbackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cache.tc,resources=redisbackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cache.tc,resources=redisbackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch
+
+// Reconcile takes a backup of a Redis instance. It asks the primary to save its data with
+// BGSAVE, waits until LASTSAVE reports the save as complete and then runs a Job copying
+// the RDB file to the target of the backup. The size and checksum of the copy are recorded
+// in the status once the Job has completed. VolumeSnapshot backups snapshot every data volume
+// instead of running a Job and complete once all snapshots are ready to use. Completed and
+// failed backups are left untouched.
+func (r *RedisBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	backup := &cachev1alpha1.RedisBackup{}
+	err := r.Get(ctx, req.NamespacedName, backup)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("RedisBackup resource not found.")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get RedisBackup")
+		return ctrl.Result{}, err
+	}
+	if backup.Status.Phase == cachev1alpha1.RedisBackupCompleted || backup.Status.Phase == cachev1alpha1.RedisBackupFailed {
+		return ctrl.Result{}, nil
+	}
+
+	if err := validateBackupTarget(backup.Spec.Target); err != nil {
+		return ctrl.Result{}, r.failBackup(ctx, backup, err.Error())
+	}
+
+	redis := &cachev1alpha1.Redis{}
+	err = r.Get(ctx, types.NamespacedName{Name: backup.Spec.RedisName, Namespace: backup.Namespace}, redis)
+	if err != nil && errors.IsNotFound(err) {
+		return r.waitForBackup(ctx, backup, fmt.Sprintf("Redis %s not found", backup.Spec.RedisName))
+	} else if err != nil {
+		logger.Error(err, "Failed to get Redis")
+		return ctrl.Result{}, err
+	}
+	if !persistenceEnabled(redis) {
+		return ctrl.Result{}, r.failBackup(ctx, backup, fmt.Sprintf("Redis %s runs without persistence and has no RDB file to back up", redis.Name))
+	}
+	if redis.Spec.Mode == cachev1alpha1.RedisModeCluster {
+		return ctrl.Result{}, r.failBackup(ctx, backup, "Backing up Redis Cluster instances is not supported")
+	}
+
+	if backup.Spec.Target.VolumeSnapshot != nil {
+		switch {
+		case backup.Status.StartTime == nil:
+			return r.startBackup(ctx, backup, redis)
+		case len(backup.Status.VolumeSnapshots) == 0:
+			return r.copyBackup(ctx, backup, redis)
+		}
+		return r.completeSnapshotBackup(ctx, backup)
+	}
+
+	foundJob := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: backupJobName(backup), Namespace: backup.Namespace}, foundJob)
+	if err != nil && errors.IsNotFound(err) {
+		if backup.Status.StartTime == nil {
+			return r.startBackup(ctx, backup, redis)
+		}
+		return r.copyBackup(ctx, backup, redis)
+	} else if err != nil {
+		logger.Error(err, "Failed to get Job")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.completeBackup(ctx, backup, foundJob)
+}
+
+// startBackup asks the primary to save its data in the background, recording its LASTSAVE
+// beforehand so that the completion of the save can be detected
+func (r *RedisBackupReconciler) startBackup(ctx context.Context, backup *cachev1alpha1.RedisBackup, redis *cachev1alpha1.Redis) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	primary := primaryPodName(redis)
+	rdb, err := r.connectPrimary(ctx, redis, primary)
+	if err != nil {
+		return r.waitForBackup(ctx, backup, fmt.Sprintf("Primary %s is not reachable: %v", primary, err))
+	}
+	defer rdb.Close()
+
+	lastSave, err := rdb.LastSave(ctx).Result()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// LASTSAVE has a resolution of one second, so a save completing in the same second as the
+	// last one would go unnoticed. Saving once the clock has moved past it rules that out.
+	serverTime, err := rdb.Time(ctx).Result()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if serverTime.Unix() <= lastSave {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+	// SCHEDULE defers the save while an append only file rewrite is in progress
+	if err := rdb.Do(ctx, "BGSAVE", "SCHEDULE").Err(); err != nil {
+		if strings.Contains(err.Error(), "already in progress") {
+			return r.waitForBackup(ctx, backup, "Waiting for a background save already in progress")
+		}
+		return ctrl.Result{}, err
+	}
+	logger.Info("Started Redis background save", "RedisBackup.Name", backup.Name, "Pod.Name", primary)
+
+	if backup.Annotations == nil {
+		backup.Annotations = map[string]string{}
+	}
+	backup.Annotations[backupPodAnnotation] = primary
+	backup.Annotations[backupLastSaveAnnotation] = strconv.FormatInt(lastSave, 10)
+	backup.Annotations[backupSaveTimeAnnotation] = strconv.FormatInt(serverTime.Unix(), 10)
+	if err := r.Update(ctx, backup); err != nil {
+		logger.Error(err, "Failed to update RedisBackup", "RedisBackup.Namespace", backup.Namespace, "RedisBackup.Name", backup.Name)
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	backup.Status.Phase = cachev1alpha1.RedisBackupRunning
+	backup.Status.StartTime = &now
+	backup.Status.Message = fmt.Sprintf("Saving the data of %s", primary)
+	if err := r.Status().Update(ctx, backup); err != nil {
+		logger.Error(err, "Failed to update RedisBackup status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: backupPollInterval}, nil
+}
+
+// backupSaveProgress reports whether the background save of a backup has completed, or why
+// the backup failed. Only a successful save moves LASTSAVE past the one recorded before BGSAVE.
+// A failed save leaves it unchanged and sets rdb_last_bgsave_status to err, which may however
+// still report an earlier save while BGSAVE SCHEDULE is deferred. The status is therefore only
+// trusted once no save or rewrite runs and a scheduled save has had the time to start since
+// the server TIME of BGSAVE. A save still running after backupSaveTimeout fails the backup.
+func backupSaveProgress(persistence map[string]string, saved, lastSave int64, saveTime, serverTime time.Time) (bool, string) {
+	if saved > lastSave {
+		return true, ""
+	}
+	idle := persistence["rdb_bgsave_in_progress"] == "0" && persistence["aof_rewrite_in_progress"] == "0"
+	if idle && persistence["rdb_last_bgsave_status"] == "err" && serverTime.Sub(saveTime) > backupSaveRetryDelay {
+		return false, "failed, see the Redis log for the reason"
+	}
+	if serverTime.Sub(saveTime) > backupSaveTimeout {
+		return false, fmt.Sprintf("did not complete within %s", backupSaveTimeout)
+	}
+	return false, ""
+}
+
+// copyBackup creates the Job copying the RDB file, or snapshots the data volumes, once the
+// background save has completed
+func (r *RedisBackupReconciler) copyBackup(ctx context.Context, backup *cachev1alpha1.RedisBackup, redis *cachev1alpha1.Redis) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	primary := backup.Annotations[backupPodAnnotation]
+	lastSave, err := strconv.ParseInt(backup.Annotations[backupLastSaveAnnotation], 10, 64)
+	saveTime, timeErr := strconv.ParseInt(backup.Annotations[backupSaveTimeAnnotation], 10, 64)
+	if primary == "" || err != nil || timeErr != nil {
+		return ctrl.Result{}, r.failBackup(ctx, backup, "The background save of the backup was not recorded")
+	}
+
+	rdb, err := r.connectPrimary(ctx, redis, primary)
+	if err != nil {
+		return r.waitForBackup(ctx, backup, fmt.Sprintf("Primary %s is not reachable: %v", primary, err))
+	}
+	defer rdb.Close()
+
+	info, err := rdb.Info(ctx, "persistence").Result()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	saved, err := rdb.LastSave(ctx).Result()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	serverTime, err := rdb.Time(ctx).Result()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if done, failure := backupSaveProgress(parseInfoFields(info), saved, lastSave, time.Unix(saveTime, 0), serverTime); failure != "" {
+		return ctrl.Result{}, r.failBackup(ctx, backup, fmt.Sprintf("Background save on %s %s", primary, failure))
+	} else if !done {
+		return ctrl.Result{RequeueAfter: backupPollInterval}, nil
+	}
+	if backup.Spec.Target.VolumeSnapshot != nil {
+		return r.snapshotBackup(ctx, backup, redis, primary)
+	}
+
+	job, err := r.jobForBackup(backup, redis, primary)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	logger.Info("Creating a new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+	if err := r.Create(ctx, job); err != nil {
+		logger.Error(err, "Failed to create new Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return ctrl.Result{}, err
+	}
+
+	backup.Status.Message = fmt.Sprintf("Copying the RDB file to %s", backupLocation(backup))
+	if err := r.Status().Update(ctx, backup); err != nil {
+		logger.Error(err, "Failed to update RedisBackup status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// completeBackup records the result of the Job copying the RDB file once it has finished
+func (r *RedisBackupReconciler) completeBackup(ctx context.Context, backup *cachev1alpha1.RedisBackup, job *batchv1.Job) error {
+	logger := log.FromContext(ctx)
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobFailed:
+			return r.failBackup(ctx, backup, fmt.Sprintf("Job %s failed: %s", job.Name, condition.Message))
+		case batchv1.JobComplete:
+			podList := &corev1.PodList{}
+			if err := r.List(ctx, podList, client.InNamespace(job.Namespace), client.MatchingLabels(job.Spec.Template.Labels)); err != nil {
+				return err
+			}
+			result, found := backupResultFromPods(podList.Items)
+			if !found {
+				return r.failBackup(ctx, backup, fmt.Sprintf("Job %s did not report the size and checksum of the RDB file", job.Name))
+			}
+
+			now := metav1.Now()
+			backup.Status.Phase = cachev1alpha1.RedisBackupCompleted
+			backup.Status.CompletionTime = &now
+			if backup.Status.StartTime != nil {
+				backup.Status.Duration = &metav1.Duration{Duration: now.Sub(backup.Status.StartTime.Time).Round(time.Second)}
+			}
+			backup.Status.Size = result.Size
+			backup.Status.Checksum = result.Checksum
+			backup.Status.Location = backupLocation(backup)
+			backup.Status.Message = ""
+			if err := r.Status().Update(ctx, backup); err != nil {
+				logger.Error(err, "Failed to update RedisBackup status")
+				return err
+			}
+			logger.Info("Completed Redis backup", "RedisBackup.Name", backup.Name, "Location", backup.Status.Location, "Size", result.Size)
+			return nil
+		}
+	}
+	return nil
+}
+
+// snapshotBackup takes a VolumeSnapshot of every data volume of the Redis instance. Only the
+// snapshot of the primary holds the saved RDB file, the others are crash-consistent.
+func (r *RedisBackupReconciler) snapshotBackup(ctx context.Context, backup *cachev1alpha1.RedisBackup, redis *cachev1alpha1.Redis, primary string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	claims, err := listDataVolumeClaims(ctx, r.Client, redis)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	names := []string{}
+	primaryFound := false
+	for _, claim := range claims {
+		names = append(names, backupSnapshotName(backup, claim.Name))
+		primaryFound = primaryFound || claim.Name == dataVolumeName+"-"+primary
+	}
+	if !primaryFound {
+		return ctrl.Result{}, r.failBackup(ctx, backup, fmt.Sprintf("Data volume claim of %s not found", primary))
+	}
+
+	for _, claim := range claims {
+		snapshot, err := r.volumeSnapshotForBackup(backup, claim.Name)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		logger.Info("Creating a new VolumeSnapshot", "VolumeSnapshot.Namespace", snapshot.GetNamespace(), "VolumeSnapshot.Name", snapshot.GetName())
+		// Snapshots created before a failed status update are kept
+		if err := r.Create(ctx, snapshot); err != nil && !errors.IsAlreadyExists(err) {
+			logger.Error(err, "Failed to create new VolumeSnapshot", "VolumeSnapshot.Namespace", snapshot.GetNamespace(), "VolumeSnapshot.Name", snapshot.GetName())
+			return ctrl.Result{}, err
+		}
+	}
+
+	backup.Status.VolumeSnapshots = names
+	backup.Status.Message = fmt.Sprintf("Waiting for %d VolumeSnapshots to be ready", len(names))
+	if err := r.Status().Update(ctx, backup); err != nil {
+		logger.Error(err, "Failed to update RedisBackup status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: backupPollInterval}, nil
+}
+
+// completeSnapshotBackup records the result of a VolumeSnapshot backup once all its snapshots
+// are ready to use. The size is the restore size of the snapshot of the primary.
+func (r *RedisBackupReconciler) completeSnapshotBackup(ctx context.Context, backup *cachev1alpha1.RedisBackup) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var size *resource.Quantity
+	pending := 0
+	for _, name := range backup.Status.VolumeSnapshots {
+		snapshot := newVolumeSnapshot()
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: backup.Namespace}, snapshot)
+		if err != nil && errors.IsNotFound(err) {
+			return ctrl.Result{}, r.failBackup(ctx, backup, fmt.Sprintf("VolumeSnapshot %s not found", name))
+		} else if err != nil {
+			return ctrl.Result{}, err
+		}
+		ready, restoreSize, message := volumeSnapshotState(snapshot)
+		if message != "" {
+			return ctrl.Result{}, r.failBackup(ctx, backup, fmt.Sprintf("VolumeSnapshot %s failed: %s", name, message))
+		}
+		if !ready {
+			pending++
+		}
+		if name == backupPrimarySnapshotName(backup) {
+			size = restoreSize
+		}
+	}
+	if pending > 0 {
+		backup.Status.Message = fmt.Sprintf("Waiting for %d of %d VolumeSnapshots to be ready", pending, len(backup.Status.VolumeSnapshots))
+		if err := r.Status().Update(ctx, backup); err != nil {
+			logger.Error(err, "Failed to update RedisBackup status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: backupPollInterval}, nil
+	}
+
+	now := metav1.Now()
+	backup.Status.Phase = cachev1alpha1.RedisBackupCompleted
+	backup.Status.CompletionTime = &now
+	if backup.Status.StartTime != nil {
+		backup.Status.Duration = &metav1.Duration{Duration: now.Sub(backup.Status.StartTime.Time).Round(time.Second)}
+	}
+	if size != nil {
+		backup.Status.Size = size.Value()
+	}
+	backup.Status.Location = backupLocation(backup)
+	backup.Status.Message = ""
+	if err := r.Status().Update(ctx, backup); err != nil {
+		logger.Error(err, "Failed to update RedisBackup status")
+		return ctrl.Result{}, err
+	}
+	logger.Info("Completed Redis backup", "RedisBackup.Name", backup.Name, "Location", backup.Status.Location, "VolumeSnapshots", len(backup.Status.VolumeSnapshots))
+	return ctrl.Result{}, nil
+}
+
+// connectPrimary returns a client connected to the given pod of the Redis instance
+func (r *RedisBackupReconciler) connectPrimary(ctx context.Context, redis *cachev1alpha1.Redis, primary string) (*goredis.Client, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: secretNameForRedis(redis), Namespace: redis.Namespace}, secret); err != nil {
+		return nil, err
+	}
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: primary, Namespace: redis.Namespace}, pod); err != nil {
+		return nil, err
+	}
+	if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+		return nil, fmt.Errorf("pod %s is not running", primary)
+	}
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return nil, err
+	}
+	return connectRedisPod(ctx, pod, tlsConfig, string(secret.Data[secretKeyForRedis(redis)]))
+}
+
+// waitForBackup records why the backup is waiting and retries later
+func (r *RedisBackupReconciler) waitForBackup(ctx context.Context, backup *cachev1alpha1.RedisBackup, message string) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("RedisBackup is waiting", "RedisBackup.Name", backup.Name, "Reason", message)
+	if backup.Status.Phase == "" {
+		backup.Status.Phase = cachev1alpha1.RedisBackupPending
+	}
+	backup.Status.Message = message
+	if err := r.Status().Update(ctx, backup); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update RedisBackup status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: backupPollInterval}, nil
+}
+
+// failBackup marks the backup as failed, which is not retried
+func (r *RedisBackupReconciler) failBackup(ctx context.Context, backup *cachev1alpha1.RedisBackup, message string) error {
+	log.FromContext(ctx).Info("RedisBackup failed", "RedisBackup.Name", backup.Name, "Reason", message)
+	now := metav1.Now()
+	backup.Status.Phase = cachev1alpha1.RedisBackupFailed
+	backup.Status.CompletionTime = &now
+	backup.Status.Message = message
+	if err := r.Status().Update(ctx, backup); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update RedisBackup status")
+		return err
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RedisBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cachev1alpha1.RedisBackup{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+)
+
+const (
+	// defaultSuccessfulBackupsHistoryLimit is the number of completed backups kept when the schedule sets no limit
+	defaultSuccessfulBackupsHistoryLimit = 5
+	// defaultFailedBackupsHistoryLimit is the number of failed backups kept when the schedule sets no limit
+	defaultFailedBackupsHistoryLimit = 1
+)
+
+// RedisBackupScheduleReconciler reconciles a RedisBackupSchedule object
+type RedisBackupScheduleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=cache.tc,resources=redisbackupschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cache.tc,resources=redisbackupschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cache.tc,resources=redisbackupschedules/finalizers,verbs=update
+
+// Reconcile creates a RedisBackup from the template of the schedule whenever the cron
+// schedule fires, and deletes the backups exceeding the history limits. Activations missed
+// while the operator was down are caught up with a single backup. No backup is created
+// while a previous one of the schedule is still pending or running; the activation is then
+// reported in the Skipped condition.
+func (r *RedisBackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	schedule := &cachev1alpha1.RedisBackupSchedule{}
+	err := r.Get(ctx, req.NamespacedName, schedule)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("RedisBackupSchedule resource not found.")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get RedisBackupSchedule")
+		return ctrl.Result{}, err
+	}
+
+	cron, err := parseCronSchedule(schedule.Spec.Schedule)
+	if err != nil {
+		logger.Info("RedisBackupSchedule has an invalid schedule", "Reason", err.Error())
+		meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+			Type:               typeScheduleValidBackupSchedule,
+			Status:             metav1.ConditionFalse,
+			Reason:             "InvalidSchedule",
+			Message:            err.Error(),
+			ObservedGeneration: schedule.Generation,
+		})
+		schedule.Status.NextScheduleTime = nil
+		if err := r.Status().Update(ctx, schedule); err != nil {
+			logger.Error(err, "Failed to update RedisBackupSchedule status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+		Type:               typeScheduleValidBackupSchedule,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ScheduleParsed",
+		Message:            fmt.Sprintf("Backups are taken on schedule %s", schedule.Spec.Schedule),
+		ObservedGeneration: schedule.Generation,
+	})
+
+	backupList := &cachev1alpha1.RedisBackupList{}
+	if err := r.List(ctx, backupList, client.InNamespace(schedule.Namespace), client.MatchingLabels{backupScheduleLabel: schedule.Name}); err != nil {
+		logger.Error(err, "Failed to list RedisBackups")
+		return ctrl.Result{}, err
+	}
+	if err := r.pruneBackups(ctx, schedule, backupList.Items); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := time.Now()
+	last := schedule.CreationTimestamp.Time
+	if schedule.Status.LastScheduleTime != nil {
+		last = schedule.Status.LastScheduleTime.Time
+	}
+	scheduled, next := missedActivation(cron, last, now)
+
+	if !scheduled.IsZero() && !schedule.Spec.Suspend {
+		if active := activeBackup(backupList.Items); active != "" {
+			logger.Info("Skipping scheduled backup while a previous one is in progress", "RedisBackup.Name", active)
+			meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+				Type:               typeSkippedBackupSchedule,
+				Status:             metav1.ConditionTrue,
+				Reason:             "BackupInProgress",
+				Message:            fmt.Sprintf("The backup scheduled at %s was skipped while RedisBackup %s is in progress", scheduled.UTC().Format(time.RFC3339), active),
+				ObservedGeneration: schedule.Generation,
+			})
+		} else {
+			backup, err := r.backupForSchedule(schedule, scheduled)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			logger.Info("Creating a new RedisBackup", "RedisBackup.Namespace", backup.Namespace, "RedisBackup.Name", backup.Name)
+			if err := r.Create(ctx, backup); err != nil && !errors.IsAlreadyExists(err) {
+				logger.Error(err, "Failed to create new RedisBackup", "RedisBackup.Namespace", backup.Namespace, "RedisBackup.Name", backup.Name)
+				return ctrl.Result{}, err
+			}
+			schedule.Status.LastBackup = backup.Name
+			meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+				Type:               typeSkippedBackupSchedule,
+				Status:             metav1.ConditionFalse,
+				Reason:             "BackupCreated",
+				Message:            fmt.Sprintf("RedisBackup %s was created as scheduled", backup.Name),
+				ObservedGeneration: schedule.Generation,
+			})
+		}
+	}
+	if !scheduled.IsZero() {
+		schedule.Status.LastScheduleTime = &metav1.Time{Time: scheduled}
+	}
+
+	result := ctrl.Result{}
+	schedule.Status.NextScheduleTime = nil
+	if !next.IsZero() {
+		schedule.Status.NextScheduleTime = &metav1.Time{Time: next}
+		result.RequeueAfter = next.Sub(now)
+	}
+	if err := r.Status().Update(ctx, schedule); err != nil {
+		logger.Error(err, "Failed to update RedisBackupSchedule status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// missedActivation returns the latest activation of the schedule after last and no later
+// than now, or the zero time when there is none, together with the next activation after now
+func missedActivation(cron *cronSchedule, last, now time.Time) (time.Time, time.Time) {
+	scheduled := time.Time{}
+	next := cron.next(last)
+	for !next.IsZero() && !next.After(now) {
+		scheduled = next
+		next = cron.next(next)
+	}
+	return scheduled, next
+}
+
+// activeBackup returns the name of a backup that is still pending or running
+func activeBackup(backups []cachev1alpha1.RedisBackup) string {
+	for _, backup := range backups {
+		if backup.Status.Phase != cachev1alpha1.RedisBackupCompleted && backup.Status.Phase != cachev1alpha1.RedisBackupFailed {
+			return backup.Name
+		}
+	}
+	return ""
+}
+
+// backupForSchedule returns the backup taken by the schedule at the given time
+func (r *RedisBackupScheduleReconciler) backupForSchedule(schedule *cachev1alpha1.RedisBackupSchedule, scheduled time.Time) (*cachev1alpha1.RedisBackup, error) {
+	backup := &cachev1alpha1.RedisBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", schedule.Name, scheduled.Unix()),
+			Namespace: schedule.Namespace,
+			Labels:    map[string]string{backupScheduleLabel: schedule.Name},
+		},
+		Spec: *schedule.Spec.Template.DeepCopy(),
+	}
+	if err := controllerutil.SetControllerReference(schedule, backup, r.Scheme); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// pruneBackups deletes the oldest completed and failed backups of the schedule beyond its history limits
+func (r *RedisBackupScheduleReconciler) pruneBackups(ctx context.Context, schedule *cachev1alpha1.RedisBackupSchedule, backups []cachev1alpha1.RedisBackup) error {
+	logger := log.FromContext(ctx)
+
+	successfulLimit := defaultSuccessfulBackupsHistoryLimit
+	if schedule.Spec.SuccessfulBackupsHistoryLimit != nil {
+		successfulLimit = int(*schedule.Spec.SuccessfulBackupsHistoryLimit)
+	}
+	failedLimit := defaultFailedBackupsHistoryLimit
+	if schedule.Spec.FailedBackupsHistoryLimit != nil {
+		failedLimit = int(*schedule.Spec.FailedBackupsHistoryLimit)
+	}
+
+	for _, expired := range expiredBackups(backups, successfulLimit, failedLimit) {
+		if err := r.Delete(ctx, &expired); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete RedisBackup", "RedisBackup.Namespace", expired.Namespace, "RedisBackup.Name", expired.Name)
+			return err
+		}
+		logger.Info("Deleted RedisBackup beyond the history limit", "RedisBackup.Namespace", expired.Namespace, "RedisBackup.Name", expired.Name)
+	}
+	return nil
+}
+
+// expiredBackups returns the backups exceeding the history limits, oldest first
+func expiredBackups(backups []cachev1alpha1.RedisBackup, successfulLimit, failedLimit int) []cachev1alpha1.RedisBackup {
+	sorted := append([]cachev1alpha1.RedisBackup{}, backups...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+	})
+
+	expired := []cachev1alpha1.RedisBackup{}
+	successful, failed := 0, 0
+	for _, backup := range sorted {
+		switch backup.Status.Phase {
+		case cachev1alpha1.RedisBackupCompleted:
+			successful++
+			if successful > successfulLimit {
+				expired = append(expired, backup)
+			}
+		case cachev1alpha1.RedisBackupFailed:
+			failed++
+			if failed > failedLimit {
+				expired = append(expired, backup)
+			}
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].CreationTimestamp.Before(&expired[j].CreationTimestamp)
+	})
+	return expired
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RedisBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cachev1alpha1.RedisBackupSchedule{}).
+		Owns(&cachev1alpha1.RedisBackup{}).
+		Complete(r)
+}
@@ -0,0 +1,348 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	stderrors "errors"
+	"fmt"
+
+	goredis "github.com/redis/go-redis/v9"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+)
+
+// RedisUserReconciler reconciles a RedisUser object
+type RedisUserReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=cache.tc,resources=redisusers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cache.tc,resources=redisusers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cache.tc,resources=redisusers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cache.tc,resources=redis,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+
+// Reconcile sets up the ACL user of a RedisUser on every running server of its Redis instance
+// with ACL SETUSER. ACL users only live in memory, so the user is set up again whenever a
+// Redis pod changes, which covers restarted servers. The user is deleted from the servers
+// with ACL DELUSER before the RedisUser is removed.
+func (r *RedisUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	user := &cachev1alpha1.RedisUser{}
+	err := r.Get(ctx, req.NamespacedName, user)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("RedisUser resource not found.")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get RedisUser")
+		return ctrl.Result{}, err
+	}
+
+	if !user.DeletionTimestamp.IsZero() {
+		if containsString(user.Finalizers, redisUserFinalizer) {
+			if err := r.deleteUser(ctx, user); err != nil {
+				logger.Error(err, "Failed to delete ACL user", "Username", user.Status.Username)
+				return ctrl.Result{}, err
+			}
+			user.Finalizers = removeString(user.Finalizers, redisUserFinalizer)
+			if err := r.Update(ctx, user); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+	if !containsString(user.Finalizers, redisUserFinalizer) {
+		user.Finalizers = append(user.Finalizers, redisUserFinalizer)
+		if err := r.Update(ctx, user); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	servers, err := r.applyUser(ctx, user)
+	if err != nil {
+		var userErr *userError
+		if !stderrors.As(err, &userErr) {
+			logger.Error(err, "Failed to set up ACL user", "Username", aclUsername(user))
+			return ctrl.Result{}, err
+		}
+		logger.Info("ACL user cannot be set up", "Reason", userErr.reason, "Message", userErr.message)
+		meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+			Type:               typeAppliedRedisUser,
+			Status:             metav1.ConditionFalse,
+			Reason:             userErr.reason,
+			Message:            userErr.message,
+			ObservedGeneration: user.Generation,
+		})
+		if err := r.Status().Update(ctx, user); err != nil {
+			logger.Error(err, "Failed to update RedisUser status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: userRequeueInterval}, nil
+	}
+
+	meta.SetStatusCondition(&user.Status.Conditions, metav1.Condition{
+		Type:               typeAppliedRedisUser,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Applied",
+		Message:            fmt.Sprintf("ACL user %s is set up on %d Redis servers", user.Status.Username, servers),
+		ObservedGeneration: user.Generation,
+	})
+	if err := r.Status().Update(ctx, user); err != nil {
+		logger.Error(err, "Failed to update RedisUser status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileUserSecret returns the name of the Secret holding the password of the user
+// together with the password. A Secret supplied through spec.secretName is only read;
+// otherwise the operator generates the Secret when it does not exist yet.
+func (r *RedisUserReconciler) reconcileUserSecret(ctx context.Context, user *cachev1alpha1.RedisUser) (string, string, error) {
+	logger := log.FromContext(ctx)
+	secretName := userSecretName(user)
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: user.Namespace}, secret)
+	if err != nil && errors.IsNotFound(err) {
+		if user.Spec.SecretName != "" {
+			return "", "", &userError{reason: "SecretNotFound", message: fmt.Sprintf("Secret %s not found", secretName)}
+		}
+		password, err := generateRandomPassword(defaultPasswordLength, alphanumericCharacters)
+		if err != nil {
+			return "", "", err
+		}
+		secret, err = r.createUserSecret(user, password)
+		if err != nil {
+			return "", "", err
+		}
+		logger.Info("Creating a new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			logger.Error(err, "Failed to create new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return "", "", err
+		}
+		return secretName, password, nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get Secret")
+		return "", "", err
+	}
+
+	password, found := secret.Data[userSecretKey(user)]
+	if !found || len(password) == 0 {
+		return "", "", &userError{reason: "SecretKeyNotFound", message: fmt.Sprintf("Secret %s has no %s key", secretName, userSecretKey(user))}
+	}
+	return secretName, string(password), nil
+}
+
+// applyUser sets up the ACL user on every running server of the Redis instance and returns
+// the number of servers. A user renamed through spec.username is deleted under its old name.
+// Instances, Secrets and rules that are not usable yet are reported as a userError.
+func (r *RedisUserReconciler) applyUser(ctx context.Context, user *cachev1alpha1.RedisUser) (int, error) {
+	logger := log.FromContext(ctx)
+	if err := validateRedisUser(user); err != nil {
+		return 0, err
+	}
+
+	redis := &cachev1alpha1.Redis{}
+	err := r.Get(ctx, types.NamespacedName{Name: user.Spec.RedisName, Namespace: user.Namespace}, redis)
+	if err != nil && errors.IsNotFound(err) {
+		return 0, &userError{reason: "RedisNotFound", message: fmt.Sprintf("Redis %s not found", user.Spec.RedisName)}
+	} else if err != nil {
+		return 0, err
+	}
+
+	secretName, password, err := r.reconcileUserSecret(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	user.Status.SecretName = secretName
+
+	pods, err := listRedisPods(ctx, r.Client, redis)
+	if err != nil {
+		return 0, err
+	}
+	if len(pods) == 0 {
+		return 0, &userError{reason: "RedisNotReady", message: fmt.Sprintf("Redis %s has no running pods", redis.Name)}
+	}
+
+	passwords, tlsConfig, err := r.defaultUserCredentials(ctx, redis)
+	if err != nil {
+		return 0, err
+	}
+
+	username := aclUsername(user)
+	args := aclSetUserArgs(user, password)
+	for i := range pods {
+		pod := &pods[i]
+		rdb, err := connectRedisPod(ctx, pod, tlsConfig, passwords...)
+		if err != nil {
+			return 0, fmt.Errorf("connect to %s: %w", pod.Name, err)
+		}
+		if previous := user.Status.Username; previous != "" && previous != username {
+			err = rdb.Do(ctx, "ACL", "DELUSER", previous).Err()
+		}
+		if err == nil {
+			err = rdb.Do(ctx, args...).Err()
+		}
+		rdb.Close()
+		// Rules Redis does not understand are rejected before the user is changed
+		var redisErr goredis.Error
+		if stderrors.As(err, &redisErr) {
+			return 0, &userError{reason: "InvalidRules", message: fmt.Sprintf("%s rejected the ACL rules: %v", pod.Name, err)}
+		} else if err != nil {
+			return 0, fmt.Errorf("set up ACL user on %s: %w", pod.Name, err)
+		}
+	}
+	if user.Status.Username != username {
+		logger.Info("Set up ACL user", "Username", username, "Redis.Name", redis.Name)
+	}
+	user.Status.Username = username
+	return len(pods), nil
+}
+
+// deleteUser deletes the ACL user from every running server of the Redis instance. Nothing is
+// left to clean up once the instance is gone or being deleted.
+func (r *RedisUserReconciler) deleteUser(ctx context.Context, user *cachev1alpha1.RedisUser) error {
+	username := user.Status.Username
+	if username == "" {
+		return nil
+	}
+
+	redis := &cachev1alpha1.Redis{}
+	err := r.Get(ctx, types.NamespacedName{Name: user.Spec.RedisName, Namespace: user.Namespace}, redis)
+	if err != nil && errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !redis.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	pods, err := listRedisPods(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+	passwords, tlsConfig, err := r.defaultUserCredentials(ctx, redis)
+	if err != nil {
+		return err
+	}
+	for i := range pods {
+		pod := &pods[i]
+		rdb, err := connectRedisPod(ctx, pod, tlsConfig, passwords...)
+		if err != nil {
+			return fmt.Errorf("connect to %s: %w", pod.Name, err)
+		}
+		err = rdb.Do(ctx, "ACL", "DELUSER", username).Err()
+		rdb.Close()
+		if err != nil {
+			return fmt.Errorf("delete ACL user on %s: %w", pod.Name, err)
+		}
+	}
+	log.FromContext(ctx).Info("Deleted ACL user", "Username", username, "Redis.Name", redis.Name)
+	return nil
+}
+
+// defaultUserCredentials returns the passwords of the default user the operator connects
+// to the Redis servers with, the previous one included while a password rotation is in
+// progress, together with the TLS configuration of the instance
+func (r *RedisUserReconciler) defaultUserCredentials(ctx context.Context, redis *cachev1alpha1.Redis) ([]string, *tls.Config, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: secretNameForRedis(redis), Namespace: redis.Namespace}, secret); err != nil {
+		return nil, nil, err
+	}
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	passwords := []string{string(secret.Data[secretKeyForRedis(redis)])}
+	if previous, found := secret.Data[previousSecretKey(redis)]; found {
+		passwords = append(passwords, string(previous))
+	}
+	return passwords, tlsConfig, nil
+}
+
+// usersForRedis maps a Redis pod or the Redis instance itself to the RedisUsers of that
+// instance, so that users are set up again on restarted servers
+func (r *RedisUserReconciler) usersForRedis(ctx context.Context, obj client.Object) []reconcile.Request {
+	redisName := obj.GetName()
+	if _, isPod := obj.(*corev1.Pod); isPod {
+		redisName = obj.GetLabels()["app"]
+	}
+	if redisName == "" {
+		return nil
+	}
+	return r.usersMatching(ctx, obj.GetNamespace(), func(user *cachev1alpha1.RedisUser) bool {
+		return user.Spec.RedisName == redisName
+	})
+}
+
+// usersForSecret maps a Secret to the RedisUsers that read their password from it, so that
+// users are set up again when a user-supplied Secret changes
+func (r *RedisUserReconciler) usersForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	return r.usersMatching(ctx, secret.GetNamespace(), func(user *cachev1alpha1.RedisUser) bool {
+		return user.Spec.SecretName == secret.GetName()
+	})
+}
+
+// usersMatching returns the requests of the RedisUsers of the namespace the given function matches
+func (r *RedisUserReconciler) usersMatching(ctx context.Context, namespace string, match func(*cachev1alpha1.RedisUser) bool) []reconcile.Request {
+	userList := &cachev1alpha1.RedisUserList{}
+	if err := r.List(ctx, userList, client.InNamespace(namespace)); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list RedisUsers", "Namespace", namespace)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for i := range userList.Items {
+		user := &userList.Items[i]
+		if match(user) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: user.Name, Namespace: user.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RedisUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cachev1alpha1.RedisUser{}).
+		Owns(&corev1.Secret{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.usersForSecret)).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.usersForRedis)).
+		Watches(&cachev1alpha1.Redis{}, handler.EnqueueRequestsFromMapFunc(r.usersForRedis)).
+		Complete(r)
+}
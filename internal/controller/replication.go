@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// replicationRequeueInterval is how long to wait before checking the replication topology again
+	// while Redis pods are still starting
+	replicationRequeueInterval = 10 * time.Second
+
+	// roleMaster and roleReplica are the roles reported by INFO replication
+	roleMaster  = "master"
+	roleReplica = "slave"
+)
+
+// podName returns the name of the StatefulSet pod with the given ordinal
+func podName(redis *cachev1alpha1.Redis, ordinal int) string {
+	return fmt.Sprintf("%s-%d", redis.Name, ordinal)
+}
+
+// podHostname returns the stable DNS name of a Redis pod behind the headless Service
+func podHostname(redis *cachev1alpha1.Redis, pod string) string {
+	return fmt.Sprintf("%s.%s.%s.svc", pod, headlessServiceName(redis), redis.Namespace)
+}
+
+// primaryPodName returns the name of the pod acting as replication primary.
+// Until the primary has been recorded in the status the first pod of the StatefulSet is used.
+func primaryPodName(redis *cachev1alpha1.Redis) string {
+	if redis.Status.Primary != "" {
+		return redis.Status.Primary
+	}
+	return podName(redis, 0)
+}
+
+// redisStartupScript returns the shell script starting redis-server in a Redis pod.
+// The first pod of the StatefulSet starts as the primary and every other pod starts
+// as a replica of it, announcing its stable DNS name to the primary. When Sentinel is
+// enabled the primary elected by the Sentinels takes precedence over the first pod, so
+// that a restarted pod does not come back as a second primary after a failover. The
+// password is rendered into the configuration file redis-server is started with. With TLS
+// enabled replicas replicate from the TLS port of the primary, and the plaintext port is
+// 0 once it is disabled.
+func redisStartupScript(redis *cachev1alpha1.Redis) string {
+	sentinelLookup := ""
+	if sentinelEnabled(redis) {
+		sentinelLookup = fmt.Sprintf(`ELECTED=$(redis-cli%s -h %s -p %d SENTINEL get-master-addr-by-name %s 2>/dev/null | head -n 1 || true)
+if [ -n "${ELECTED}" ]; then
+  PRIMARY="${ELECTED}"
+fi
+`, redisCLITLSFlags(redis), sentinelName(redis), sentinelServerPort(redis), sentinelMasterName)
+	}
+
+	return fmt.Sprintf(`set -e
+%[7]sSELF="${HOSTNAME}.%[3]s.%[4]s.svc"
+PRIMARY="%[5]s"
+%[6]sARGS="--port %[1]d --dir %[2]s --replica-announce-ip ${SELF}"
+if [ "${PRIMARY}" != "${SELF}" ]; then
+  ARGS="${ARGS} --replicaof ${PRIMARY} %[9]d"
+fi
+exec redis-server %[8]s/redis.conf ${ARGS}
+`, redisListenPort(redis), redisDataDir, headlessServiceName(redis), redis.Namespace,
+		podHostname(redis, podName(redis, 0)), sentinelLookup, redisAuthConfigScript(), redisConfigDir,
+		redisServerPort(redis))
+}
+
+// reconcileReplication makes sure the primary pod is a master and every other running
+// pod replicates from it, and records the primary in the status of the Redis instance.
+// Pods that cannot be reached yet are retried on the next reconciliation. When Sentinel
+// is enabled the topology is owned by the Sentinels, so the primary they elected is only
+// observed and recorded.
+func (r *RedisReconciler) reconcileReplication(ctx context.Context, redis *cachev1alpha1.Redis, password string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pods, err := listRedisPods(ctx, r.Client, redis)
+	if err != nil {
+		logger.Error(err, "Failed to list Redis pods")
+		return ctrl.Result{}, err
+	}
+
+	if sentinelEnabled(redis) {
+		primary, err := r.sentinelPrimary(ctx, redis, pods)
+		if err != nil {
+			logger.Info("Primary not yet known to Sentinel", "Reason", err.Error())
+			return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+		}
+		if primary != redis.Status.Primary {
+			logger.Info("Sentinel reports new primary", "Previous", redis.Status.Primary, "Primary", primary)
+		}
+		redis.Status.Primary = primary
+		// Keep polling, Sentinel may fail over at any time
+		return ctrl.Result{RequeueAfter: sentinelPollInterval}, nil
+	}
+
+	primary := primaryPodName(redis)
+	primaryFound := false
+	requeue := len(pods) < int(desiredReplicas(redis))
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Name == primary {
+			primaryFound = true
+		}
+		if err := r.ensureReplicationRole(ctx, redis, pod, password, primary); err != nil {
+			logger.Info("Redis pod is not ready for replication yet", "Pod.Name", pod.Name, "Reason", err.Error())
+			requeue = true
+		}
+	}
+
+	if primaryFound {
+		redis.Status.Primary = primary
+	}
+	if requeue || !primaryFound {
+		return ctrl.Result{RequeueAfter: replicationRequeueInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// ensureReplicationRole promotes the pod when it is the primary and otherwise points it at the primary
+func (r *RedisReconciler) ensureReplicationRole(ctx context.Context, redis *cachev1alpha1.Redis, pod *corev1.Pod, password, primary string) error {
+	logger := log.FromContext(ctx)
+
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+	rdb := newRedisClient(pod, tlsConfig, password)
+	defer rdb.Close()
+
+	info, err := rdb.InfoMap(ctx, "replication").Result()
+	if err != nil {
+		return err
+	}
+	role := info["Replication"]["role"]
+
+	if pod.Name == primary {
+		if role == roleMaster {
+			return nil
+		}
+		logger.Info("Promoting Redis pod to primary", "Pod.Name", pod.Name)
+		return rdb.Do(ctx, "REPLICAOF", "NO", "ONE").Err()
+	}
+
+	primaryHost := podHostname(redis, primary)
+	if role == roleReplica && info["Replication"]["master_host"] == primaryHost {
+		return nil
+	}
+	logger.Info("Configuring Redis pod as replica", "Pod.Name", pod.Name, "Primary", primary)
+	return rdb.Do(ctx, "REPLICAOF", primaryHost, strconv.Itoa(redisServerPort(redis))).Err()
+}
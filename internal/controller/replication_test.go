@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestPrimaryPodName tests that the first pod is the primary until the status records another one
+func TestPrimaryPodName(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+	}
+
+	assert.Equal(t, "test-redis-0", primaryPodName(redis), "First pod should be the initial primary")
+
+	redis.Status.Primary = "test-redis-2"
+	assert.Equal(t, "test-redis-2", primaryPodName(redis), "Primary should be read from the status")
+}
+
+// TestPodHostname tests the stable DNS name of a Redis pod
+func TestPodHostname(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "cache",
+		},
+	}
+
+	assert.Equal(t, "test-redis-1.test-redis-headless.cache.svc", podHostname(redis, "test-redis-1"), "Pod hostname should use the headless Service")
+}
+
+// TestRedisStartupScript tests that replicas are started pointing at the first pod
+func TestRedisStartupScript(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+	}
+
+	script := redisStartupScript(redis)
+
+	assert.Contains(t, script, `PRIMARY="test-redis-0.test-redis-headless.default.svc"`, "First pod should be the initial primary")
+	assert.Contains(t, script, `--replicaof ${PRIMARY} 6379`, "Replicas should replicate from the primary")
+	assert.Contains(t, script, `masterauth "${PASSWORD}"`, "Replicas should authenticate against the primary")
+	assert.Contains(t, script, `requirepass "${PASSWORD}"`, "Clients should have to authenticate")
+	assert.Contains(t, script, "exec redis-server /etc/redis/redis.conf", "Redis should start from the rendered configuration")
+	assert.NotContains(t, script, "--requirepass", "Password should not be passed on the command line")
+	assert.NotContains(t, script, "SENTINEL", "Sentinel should not be consulted when disabled")
+}
+
+// TestRedisStartupScriptSentinel tests that the primary elected by Sentinel is preferred over the first pod
+func TestRedisStartupScriptSentinel(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			Sentinel: &cachev1alpha1.RedisSentinel{Replicas: 3, Quorum: 2},
+		},
+	}
+
+	script := redisStartupScript(redis)
+
+	assert.Contains(t, script, "redis-cli -h test-redis-sentinel -p 26379 SENTINEL get-master-addr-by-name mymaster", "Sentinel should be asked for the current primary")
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// slotsPerReconcile bounds the number of hash slots migrated in one reconciliation so
+	// that progress is persisted in the status regularly
+	slotsPerReconcile = 128
+	// migrateKeysPerBatch is the number of keys moved by a single MIGRATE command
+	migrateKeysPerBatch = 100
+	// migrateTimeoutMilliseconds is the timeout of a single MIGRATE command
+	migrateTimeoutMilliseconds = 5000
+)
+
+// slotMove is the migration of a hash slot from one shard to another
+type slotMove struct {
+	Slot int
+	From int
+	To   int
+}
+
+// planSlotMoves returns the hash slot migrations that give every one of the given number of
+// shards its even share of slots. owners maps every slot to the shard serving it, or -1 when
+// it is unassigned or served by an unknown node. Shards beyond the given number give away
+// all their slots. Shards keep their lowest slots and hand out their highest ones, so the
+// number of migrated slots is minimal.
+func planSlotMoves(owners []int, shards int) []slotMove {
+	counts := map[int]int{}
+	for _, owner := range owners {
+		if owner >= 0 {
+			counts[owner]++
+		}
+	}
+
+	targets := map[int]int{}
+	for shard, slots := range slotRanges(shards) {
+		targets[shard] = slots.End - slots.Start + 1
+	}
+
+	surplus := map[int]int{}
+	for shard, count := range counts {
+		if count > targets[shard] {
+			surplus[shard] = count - targets[shard]
+		}
+	}
+	deficit := make([]int, shards)
+	for shard := 0; shard < shards; shard++ {
+		if counts[shard] < targets[shard] {
+			deficit[shard] = targets[shard] - counts[shard]
+		}
+	}
+
+	moves := []slotMove{}
+	receiver := 0
+	for slot := len(owners) - 1; slot >= 0; slot-- {
+		owner := owners[slot]
+		if owner < 0 || surplus[owner] == 0 {
+			continue
+		}
+		for receiver < shards && deficit[receiver] == 0 {
+			receiver++
+		}
+		if receiver == shards {
+			break
+		}
+		moves = append(moves, slotMove{Slot: slot, From: owner, To: receiver})
+		surplus[owner]--
+		deficit[receiver]--
+	}
+	return moves
+}
+
+// rebalanceCluster migrates a batch of hash slots towards an even spread across spec.shards
+// and records the progress in the status. Migrations interrupted by a restart of the
+// operator are completed first. It returns true once no slot needs to move anymore, at
+// which point shards that are being removed hold no slots and can be deprovisioned.
+func (r *RedisReconciler) rebalanceCluster(ctx context.Context, redis *cachev1alpha1.Redis, members []*clusterMember, shards [][]*clusterMember, password string) (bool, error) {
+	logger := log.FromContext(ctx)
+	status := redis.Status.Cluster
+
+	// Added shards take part right away, removed shards are kept until they are drained
+	if status.Shards < redis.Spec.Shards {
+		status.Shards = redis.Spec.Shards
+	}
+
+	byID := map[string]*clusterMember{}
+	shardOfID := map[string]int{}
+	for index, shard := range shards {
+		for _, member := range shard {
+			byID[member.self().ID] = member
+			shardOfID[member.self().ID] = index
+		}
+	}
+
+	// Complete the migrations that were in flight when the operator stopped
+	moved := 0
+	for _, member := range members {
+		for slot, targetID := range member.self().Migrating {
+			target, found := byID[targetID]
+			if !found {
+				return false, fmt.Errorf("slot %d is migrating to unknown node %s", slot, targetID)
+			}
+			logger.Info("Resuming hash slot migration", "Slot", slot, "From", member.pod.Name, "To", target.pod.Name)
+			if err := migrateSlot(ctx, member, target, slot, password); err != nil {
+				return false, err
+			}
+			moved++
+		}
+	}
+
+	owners := make([]int, clusterSlots)
+	for slot := range owners {
+		owners[slot] = -1
+	}
+	for _, node := range members[0].nodes {
+		shard, found := shardOfID[node.ID]
+		if !found || !node.Master {
+			continue
+		}
+		for _, slots := range node.Slots {
+			for slot := slots.Start; slot <= slots.End; slot++ {
+				owners[slot] = shard
+			}
+		}
+	}
+
+	moves := planSlotMoves(owners, int(redis.Spec.Shards))
+	if len(moves) == 0 && moved == 0 {
+		if status.Rebalance != nil {
+			logger.Info("Hash slot rebalance completed", "Shards", redis.Spec.Shards, "SlotsMoved", status.Rebalance.SlotsMoved)
+		}
+		status.Rebalance = nil
+		status.Shards = redis.Spec.Shards
+		return true, nil
+	}
+
+	if status.Rebalance == nil || status.Rebalance.TargetShards != redis.Spec.Shards {
+		logger.Info("Starting hash slot rebalance", "Shards", redis.Spec.Shards, "Slots", len(moves))
+		status.Rebalance = &cachev1alpha1.RedisClusterRebalance{
+			TargetShards: redis.Spec.Shards,
+			StartTime:    metav1.Now(),
+		}
+	}
+
+	batch := moves[:min(len(moves), slotsPerReconcile)]
+	for _, move := range batch {
+		source := shardPrimary(shards[move.From])
+		target := shardPrimary(shards[move.To])
+		if !target.self().Master {
+			return false, fmt.Errorf("primary %s of shard %d is not a master", target.pod.Name, move.To)
+		}
+		if err := migrateSlot(ctx, source, target, move.Slot, password); err != nil {
+			return false, err
+		}
+		moved++
+	}
+
+	status.Rebalance.SlotsMoved += int32(moved)
+	status.Rebalance.SlotsPending = int32(len(moves) - len(batch))
+	logger.Info("Migrated hash slots", "Moved", moved, "Pending", status.Rebalance.SlotsPending)
+	return false, nil
+}
+
+// migrateSlot moves a hash slot together with its keys from the source to the target primary.
+// Every step is idempotent, so an interrupted migration can be run again.
+func migrateSlot(ctx context.Context, source, target *clusterMember, slot int, password string) error {
+	sourceID := source.self().ID
+	targetID := target.self().ID
+
+	if err := target.client.Do(ctx, "CLUSTER", "SETSLOT", slot, "IMPORTING", sourceID).Err(); err != nil {
+		return fmt.Errorf("set slot %d importing on %s: %w", slot, target.pod.Name, err)
+	}
+	if err := source.client.Do(ctx, "CLUSTER", "SETSLOT", slot, "MIGRATING", targetID).Err(); err != nil {
+		return fmt.Errorf("set slot %d migrating on %s: %w", slot, source.pod.Name, err)
+	}
+
+	for {
+		keys, err := source.client.ClusterGetKeysInSlot(ctx, slot, migrateKeysPerBatch).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			break
+		}
+		// The target is reached on the port the operator connects to, the TLS port with TLS enabled
+		host, port, err := net.SplitHostPort(target.client.Options().Addr)
+		if err != nil {
+			return err
+		}
+		args := []interface{}{"MIGRATE", host, port, "", 0, migrateTimeoutMilliseconds, "REPLACE"}
+		if password != "" {
+			args = append(args, "AUTH", password)
+		}
+		args = append(args, "KEYS")
+		for _, key := range keys {
+			args = append(args, key)
+		}
+		if err := source.client.Do(ctx, args...).Err(); err != nil {
+			return fmt.Errorf("migrate slot %d keys to %s: %w", slot, target.pod.Name, err)
+		}
+	}
+
+	// Assign the slot to the target on both sides, the other nodes learn it through gossip
+	for _, member := range []*clusterMember{target, source} {
+		if err := member.client.Do(ctx, "CLUSTER", "SETSLOT", slot, "NODE", targetID).Err(); err != nil {
+			return fmt.Errorf("assign slot %d on %s: %w", slot, member.pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// forgetRemovedNodes makes every member forget the failed nodes that no longer belong to a
+// running pod, such as the nodes of removed shards once their pods are gone
+func forgetRemovedNodes(ctx context.Context, members []*clusterMember) error {
+	logger := log.FromContext(ctx)
+
+	running := map[string]bool{}
+	for _, member := range members {
+		running[member.pod.Status.PodIP] = true
+	}
+
+	for _, node := range members[0].nodes {
+		if node.Myself || !node.Failed || running[node.IP] || node.slotCount() > 0 {
+			continue
+		}
+		logger.Info("Forgetting removed cluster node", "Node", node.ID)
+		for _, member := range members {
+			err := member.client.ClusterForget(ctx, node.ID).Err()
+			if err != nil && !strings.Contains(err.Error(), "Unknown node") {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+// ownersFor returns the slot owners of a cluster whose slots are spread evenly across the given shards
+func ownersFor(shards int) []int {
+	owners := make([]int, clusterSlots)
+	for shard, slots := range slotRanges(shards) {
+		for slot := slots.Start; slot <= slots.End; slot++ {
+			owners[slot] = shard
+		}
+	}
+	return owners
+}
+
+// countsAfter applies the moves to the owners and returns the number of slots per shard
+func countsAfter(owners []int, moves []slotMove) map[int]int {
+	for _, move := range moves {
+		owners[move.Slot] = move.To
+	}
+	counts := map[int]int{}
+	for _, owner := range owners {
+		counts[owner]++
+	}
+	return counts
+}
+
+// TestPlanSlotMovesBalanced tests that a balanced cluster needs no migration
+func TestPlanSlotMovesBalanced(t *testing.T) {
+	moves := planSlotMoves(ownersFor(3), 3)
+
+	assert.Empty(t, moves, "Balanced cluster should not move slots")
+}
+
+// TestPlanSlotMovesScaleUp tests that added shards receive an even share of slots
+func TestPlanSlotMovesScaleUp(t *testing.T) {
+	owners := ownersFor(3)
+
+	moves := planSlotMoves(owners, 4)
+
+	assert.Len(t, moves, 4096, "Only the new shard's share should move")
+	for _, move := range moves {
+		assert.Equal(t, 3, move.To, "Slots should move to the new shard")
+	}
+	counts := countsAfter(owners, moves)
+	assert.Equal(t, map[int]int{0: 4096, 1: 4096, 2: 4096, 3: 4096}, counts, "Every shard should serve an even share")
+}
+
+// TestPlanSlotMovesScaleDown tests that removed shards are drained
+func TestPlanSlotMovesScaleDown(t *testing.T) {
+	owners := ownersFor(4)
+
+	moves := planSlotMoves(owners, 3)
+
+	assert.Len(t, moves, 4096, "Only the removed shard's slots should move")
+	for _, move := range moves {
+		assert.Equal(t, 3, move.From, "Slots should move away from the removed shard")
+	}
+	counts := countsAfter(owners, moves)
+	assert.Equal(t, 0, counts[3], "Removed shard should not serve any slot")
+	assert.Equal(t, clusterSlots, counts[0]+counts[1]+counts[2], "Remaining shards should serve every slot")
+	assert.InDelta(t, counts[0], counts[2], 1, "Remaining shards should serve an even share")
+}
+
+// TestPlanSlotMovesSkipsUnassigned tests that unassigned slots are not planned
+func TestPlanSlotMovesSkipsUnassigned(t *testing.T) {
+	owners := ownersFor(2)
+	owners[0] = -1
+
+	moves := planSlotMoves(owners, 2)
+
+	for _, move := range moves {
+		assert.NotEqual(t, 0, move.Slot, "Unassigned slot should not move")
+	}
+}
+
+// TestClusterShardsDuringScaleDown tests that removed shards stay provisioned until drained
+func TestClusterShardsDuringScaleDown(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		Spec: cachev1alpha1.RedisSpec{
+			Mode:             cachev1alpha1.RedisModeCluster,
+			Shards:           2,
+			ReplicasPerShard: 1,
+		},
+		Status: cachev1alpha1.RedisStatus{
+			Cluster: &cachev1alpha1.RedisClusterStatus{Shards: 3},
+		},
+	}
+
+	assert.Equal(t, int32(3), clusterShards(redis), "Removed shard should stay provisioned")
+	assert.Equal(t, int32(6), desiredReplicas(redis), "Pods of the removed shard should be kept")
+
+	redis.Spec.Shards = 4
+	assert.Equal(t, int32(4), clusterShards(redis), "Added shard should be provisioned right away")
+}
@@ -0,0 +1,371 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// restoreContainerName is the name of the init container seeding the data volume
+	restoreContainerName = "restore"
+	// restoreDownloadContainerName is the name of the init container downloading the RDB file from an object store
+	restoreDownloadContainerName = "restore-download"
+	// restoreVolumeName is the name of the volume the RDB file is restored from
+	restoreVolumeName = "restore"
+	// restoreDir is where the volume the RDB file is restored from is mounted
+	restoreDir = "/restore"
+)
+
+// restoreSource is the resolved location of the RDB file a Redis instance is restored from
+type restoreSource struct {
+	pvc *cachev1alpha1.RedisRestorePVCSource
+	s3  *cachev1alpha1.RedisRestoreS3Source
+	// volumeSnapshot is the name of the VolumeSnapshot the data volume of the first pod is provisioned from
+	volumeSnapshot string
+	// checksum is the expected SHA-256 checksum of the RDB file, as sha256:<hex>, when known
+	checksum string
+}
+
+// restoreError reports why the source of spec.restoreFrom cannot be used yet. Its reason
+// is surfaced in the Restored condition.
+type restoreError struct {
+	reason  string
+	message string
+}
+
+func (e *restoreError) Error() string {
+	return e.message
+}
+
+// parseS3URL returns the bucket and key of an s3://<bucket>/<key> URL
+func parseS3URL(location string) (string, string, error) {
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Scheme != "s3" || parsed.Host == "" || strings.TrimPrefix(parsed.Path, "/") == "" {
+		return "", "", fmt.Errorf("%q must be an s3://<bucket>/<key> URL", location)
+	}
+	return parsed.Host, strings.TrimPrefix(parsed.Path, "/"), nil
+}
+
+// restoreFromDescription names the source of spec.restoreFrom in the Restored condition
+func restoreFromDescription(from *cachev1alpha1.RedisRestoreSource) string {
+	switch {
+	case from.BackupName != "":
+		return fmt.Sprintf("RedisBackup %s", from.BackupName)
+	case from.PVC != nil:
+		return fmt.Sprintf("pvc://%s%s", from.PVC.ClaimName, path.Join("/", from.PVC.Path))
+	case from.S3 != nil:
+		return from.S3.URL
+	case from.VolumeSnapshotName != "":
+		return fmt.Sprintf("VolumeSnapshot %s", from.VolumeSnapshotName)
+	}
+	return ""
+}
+
+// resolveRestoreSource returns the location of the RDB file spec.restoreFrom points to. The
+// instance must persist its data. A referenced RedisBackup must have completed; its checksum is verified once the file is restored.
+// A VolumeSnapshot must be ready to use and fit in spec.storage.size.
+func (r *RedisReconciler) resolveRestoreSource(ctx context.Context, redis *cachev1alpha1.Redis) (*restoreSource, error) {
+	from := redis.Spec.RestoreFrom
+	sources := 0
+	for _, set := range []bool{from.BackupName != "", from.PVC != nil, from.S3 != nil, from.VolumeSnapshotName != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, &restoreError{reason: "InvalidSource", message: "exactly one of restoreFrom.backupName, restoreFrom.pvc, restoreFrom.s3 and restoreFrom.volumeSnapshotName must be set"}
+	}
+	if isClusterMode(redis) {
+		return nil, &restoreError{reason: "UnsupportedMode", message: "Restoring Redis Cluster instances is not supported"}
+	}
+	// The data of an emptyDir volume is lost once the restore init containers are removed
+	if !persistenceEnabled(redis) {
+		return nil, &restoreError{reason: "UnsupportedMode", message: "Restoring needs persistence to keep the restored data on a volume"}
+	}
+
+	switch {
+	case from.VolumeSnapshotName != "":
+		return r.resolveVolumeSnapshotSource(ctx, redis, from.VolumeSnapshotName)
+	case from.PVC != nil:
+		return &restoreSource{pvc: from.PVC}, nil
+	case from.S3 != nil:
+		if err := validateBackupTarget(cachev1alpha1.RedisBackupTarget{S3: &cachev1alpha1.RedisBackupS3Target{Endpoint: from.S3.Endpoint}}); err != nil {
+			return nil, &restoreError{reason: "InvalidSource", message: err.Error()}
+		}
+		if _, _, err := parseS3URL(from.S3.URL); err != nil {
+			return nil, &restoreError{reason: "InvalidSource", message: err.Error()}
+		}
+		return &restoreSource{s3: from.S3}, nil
+	}
+
+	backup := &cachev1alpha1.RedisBackup{}
+	err := r.Get(ctx, types.NamespacedName{Name: from.BackupName, Namespace: redis.Namespace}, backup)
+	if err != nil && errors.IsNotFound(err) {
+		return nil, &restoreError{reason: "BackupNotFound", message: fmt.Sprintf("RedisBackup %s not found", from.BackupName)}
+	} else if err != nil {
+		return nil, err
+	}
+	if backup.Status.Phase != cachev1alpha1.RedisBackupCompleted {
+		return nil, &restoreError{reason: "BackupNotCompleted", message: fmt.Sprintf("RedisBackup %s has not completed", from.BackupName)}
+	}
+
+	if backup.Spec.Target.VolumeSnapshot != nil {
+		return r.resolveVolumeSnapshotSource(ctx, redis, backupPrimarySnapshotName(backup))
+	}
+
+	source := &restoreSource{checksum: backup.Status.Checksum}
+	if target := backup.Spec.Target.S3; target != nil {
+		source.s3 = &cachev1alpha1.RedisRestoreS3Source{
+			Endpoint:          target.Endpoint,
+			URL:               fmt.Sprintf("s3://%s/%s", target.Bucket, backupObjectKey(backup)),
+			CredentialsSecret: target.CredentialsSecret,
+			Image:             target.Image,
+		}
+	} else {
+		source.pvc = &cachev1alpha1.RedisRestorePVCSource{ClaimName: backup.Spec.Target.PVC.ClaimName, Path: backupPVCPath(backup)}
+	}
+	return source, nil
+}
+
+// resolveVolumeSnapshotSource checks that the data volume can be provisioned from the VolumeSnapshot
+func (r *RedisReconciler) resolveVolumeSnapshotSource(ctx context.Context, redis *cachev1alpha1.Redis, name string) (*restoreSource, error) {
+	if !persistenceEnabled(redis) {
+		return nil, &restoreError{reason: "UnsupportedMode", message: "Restoring from a VolumeSnapshot needs persistence to provision the data volume"}
+	}
+
+	snapshot := newVolumeSnapshot()
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: redis.Namespace}, snapshot)
+	if err != nil && (errors.IsNotFound(err) || meta.IsNoMatchError(err)) {
+		return nil, &restoreError{reason: "SnapshotNotFound", message: fmt.Sprintf("VolumeSnapshot %s not found", name)}
+	} else if err != nil {
+		return nil, err
+	}
+	ready, restoreSize, _ := volumeSnapshotState(snapshot)
+	if !ready {
+		return nil, &restoreError{reason: "SnapshotNotReady", message: fmt.Sprintf("VolumeSnapshot %s is not ready to use", name)}
+	}
+	size, err := resource.ParseQuantity(redis.Spec.Storage.Size)
+	if err != nil {
+		return nil, err
+	}
+	if restoreSize != nil && restoreSize.Cmp(size) > 0 {
+		return nil, &restoreError{reason: "SnapshotTooLarge", message: fmt.Sprintf("VolumeSnapshot %s needs %s, more than spec.storage.size %s", name, restoreSize.String(), size.String())}
+	}
+	return &restoreSource{volumeSnapshot: name}, nil
+}
+
+// provisionFromVolumeSnapshot creates the data volume claim of the first pod with the
+// VolumeSnapshot as its data source, before the StatefulSet adopts the claim by its name.
+// An existing claim, such as a retained one, is left untouched, and it reports false unless
+// that claim was provisioned from the same VolumeSnapshot.
+func (r *RedisReconciler) provisionFromVolumeSnapshot(ctx context.Context, redis *cachev1alpha1.Redis, name string) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	claim, err := volumeClaimForRedis(redis)
+	if err != nil {
+		return false, err
+	}
+	claim.Name = dataVolumeName + "-" + podName(redis, 0)
+	claim.Namespace = redis.Namespace
+	apiGroup := volumeSnapshotGroup
+	claim.Spec.DataSource = &corev1.TypedLocalObjectReference{APIGroup: &apiGroup, Kind: volumeSnapshotKind, Name: name}
+
+	foundClaim := &corev1.PersistentVolumeClaim{}
+	err = r.Get(ctx, types.NamespacedName{Name: claim.Name, Namespace: claim.Namespace}, foundClaim)
+	if err == nil {
+		if source := foundClaim.Spec.DataSource; source != nil && source.Kind == volumeSnapshotKind && source.Name == name {
+			return true, nil
+		}
+		logger.Info("Data volume claim already exists, skipping the restore", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name)
+		return false, nil
+	} else if !errors.IsNotFound(err) {
+		return false, err
+	}
+	logger.Info("Creating a new PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name, "VolumeSnapshot", name)
+	if err := r.Create(ctx, &claim); err != nil {
+		logger.Error(err, "Failed to create new PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name)
+		return false, err
+	}
+	return true, nil
+}
+
+// restoreScript returns the shell script copying the RDB file from SOURCE to DESTINATION and
+// verifying its checksum. A data directory already holding data is left untouched, so that
+// pods restarted later never overwrite their data.
+func restoreScript() string {
+	return `set -e
+if [ -e "${DESTINATION}" ] || [ -d "$(dirname "${DESTINATION}")/appendonlydir" ]; then
+  echo "Data directory is not empty, skipping the restore"
+  exit 0
+fi
+cp "${SOURCE}" "${DESTINATION}.restore"
+if [ -n "${CHECKSUM}" ]; then
+  ACTUAL="sha256:$(sha256sum "${DESTINATION}.restore" | cut -d ' ' -f 1)"
+  if [ "${ACTUAL}" != "${CHECKSUM}" ]; then
+    rm -f "${DESTINATION}.restore"
+    echo "Checksum ${ACTUAL} of the RDB file does not match ${CHECKSUM}" | tee /dev/termination-log >&2
+    exit 1
+  fi
+fi
+mv "${DESTINATION}.restore" "${DESTINATION}"
+`
+}
+
+// addRestoreToStatefulSet adds the init containers seeding the data volume from the source
+// to a new StatefulSet. It runs a single pod until the restore has completed, the replicas
+// then sync from the restored primary.
+func addRestoreToStatefulSet(statefulSet *appsv1.StatefulSet, redis *cachev1alpha1.Redis, source *restoreSource) error {
+	restore := corev1.Container{
+		Name:    restoreContainerName,
+		Image:   redis.Spec.Image + ":" + redis.Spec.Version,
+		Command: []string{"sh", "-c", restoreScript()},
+		Env: []corev1.EnvVar{
+			{Name: "DESTINATION", Value: path.Join(redisDataDir, rdbFilenameForRedis(redis))},
+			{Name: "CHECKSUM", Value: source.checksum},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: dataVolumeName, MountPath: redisDataDir},
+			{Name: restoreVolumeName, MountPath: restoreDir, ReadOnly: true},
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+	initContainers := []corev1.Container{}
+
+	volume := corev1.Volume{Name: restoreVolumeName}
+	if source.pvc != nil {
+		restore.Env = append(restore.Env, corev1.EnvVar{Name: "SOURCE", Value: path.Join(restoreDir, source.pvc.Path)})
+		volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: source.pvc.ClaimName, ReadOnly: true}
+	} else {
+		endpoint, err := url.Parse(source.s3.Endpoint)
+		if err != nil {
+			return err
+		}
+		bucket, key, err := parseS3URL(source.s3.URL)
+		if err != nil {
+			return err
+		}
+		image := source.s3.Image
+		if image == "" {
+			image = defaultBackupS3Image
+		}
+		downloaded := path.Join(restoreDir, path.Base(key))
+
+		restore.Env = append(restore.Env, corev1.EnvVar{Name: "SOURCE", Value: downloaded})
+		volume.EmptyDir = &corev1.EmptyDirVolumeSource{}
+		initContainers = append(initContainers, corev1.Container{
+			Name:                     restoreDownloadContainerName,
+			Image:                    image,
+			Command:                  minioClientCommand("cp", "--quiet", path.Join(backupS3Alias, bucket, key), downloaded),
+			Env:                      minioClientEnv(endpoint, source.s3.CredentialsSecret),
+			VolumeMounts:             []corev1.VolumeMount{{Name: restoreVolumeName, MountPath: restoreDir}},
+			TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		})
+	}
+
+	replicas := int32(1)
+	statefulSet.Spec.Replicas = &replicas
+	podSpec := &statefulSet.Spec.Template.Spec
+	podSpec.InitContainers = append(podSpec.InitContainers, append(initContainers, restore)...)
+	podSpec.Volumes = append(podSpec.Volumes, volume)
+	return nil
+}
+
+// restoring reports whether the StatefulSet still runs the init containers of a restore
+func restoring(statefulSet *appsv1.StatefulSet) bool {
+	for _, container := range statefulSet.Spec.Template.Spec.InitContainers {
+		if container.Name == restoreContainerName {
+			return true
+		}
+	}
+	return false
+}
+
+// removeRestoreFromStatefulSet removes the init containers and volume of a completed restore
+func removeRestoreFromStatefulSet(statefulSet *appsv1.StatefulSet) {
+	podSpec := &statefulSet.Spec.Template.Spec
+	initContainers := []corev1.Container{}
+	for _, container := range podSpec.InitContainers {
+		if container.Name != restoreContainerName && container.Name != restoreDownloadContainerName {
+			initContainers = append(initContainers, container)
+		}
+	}
+	podSpec.InitContainers = initContainers
+	volumes := []corev1.Volume{}
+	for _, volume := range podSpec.Volumes {
+		if volume.Name != restoreVolumeName {
+			volumes = append(volumes, volume)
+		}
+	}
+	podSpec.Volumes = volumes
+}
+
+// reconcileRestore follows the restore of a StatefulSet created from spec.restoreFrom and
+// reports whether it is still in progress. Once the first pod has seeded its data volume the
+// restore init containers are removed, which restarts the pod once, and the Restored
+// condition is set. A failed restore is reported in the Restored condition.
+func (r *RedisReconciler) reconcileRestore(ctx context.Context, redis *cachev1alpha1.Redis, statefulSet *appsv1.StatefulSet) (bool, error) {
+	logger := log.FromContext(ctx)
+	if !restoring(statefulSet) {
+		return false, nil
+	}
+
+	condition := metav1.Condition{
+		Type:               typeRestoredRedis,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Restoring",
+		Message:            fmt.Sprintf("Seeding the data volume from %s", restoreFromDescription(redis.Spec.RestoreFrom)),
+		ObservedGeneration: redis.Generation,
+	}
+
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: podName(redis, 0), Namespace: redis.Namespace}, pod)
+	if err != nil && !errors.IsNotFound(err) {
+		return true, err
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if terminated == nil || terminated.ExitCode == 0 {
+			continue
+		}
+		condition.Reason = "RestoreFailed"
+		condition.Message = fmt.Sprintf("Init container %s failed: %s", status.Name, strings.TrimSpace(terminated.Message))
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != restoreContainerName || status.State.Terminated == nil || status.State.Terminated.ExitCode != 0 {
+			continue
+		}
+		removeRestoreFromStatefulSet(statefulSet)
+		if err := r.Update(ctx, statefulSet); err != nil {
+			logger.Error(err, "Failed to update StatefulSet", "StatefulSet.Namespace", statefulSet.Namespace, "StatefulSet.Name", statefulSet.Name)
+			return true, err
+		}
+		logger.Info("Restored Redis data", "StatefulSet.Namespace", statefulSet.Namespace, "StatefulSet.Name", statefulSet.Name)
+		meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+			Type:               typeRestoredRedis,
+			Status:             metav1.ConditionTrue,
+			Reason:             "DataRestored",
+			Message:            fmt.Sprintf("The data volume was seeded from %s", restoreFromDescription(redis.Spec.RestoreFrom)),
+			ObservedGeneration: redis.Generation,
+		})
+		return false, nil
+	}
+
+	meta.SetStatusCondition(&redis.Status.Conditions, condition)
+	return true, nil
+}
@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TestResolveRestoreSourceFromBackup tests that a completed RedisBackup is resolved to its RDB file
+func TestResolveRestoreSourceFromBackup(t *testing.T) {
+	// Arrange
+	backup := &cachev1alpha1.RedisBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default"},
+		Spec: cachev1alpha1.RedisBackupSpec{
+			RedisName: "old-redis",
+			Target: cachev1alpha1.RedisBackupTarget{
+				S3: &cachev1alpha1.RedisBackupS3Target{Endpoint: "http://minio:9000", Bucket: "backups", Prefix: "redis", CredentialsSecret: "minio"},
+			},
+		},
+		Status: cachev1alpha1.RedisBackupStatus{Phase: cachev1alpha1.RedisBackupRunning},
+	}
+	redis := newTestRedis()
+	redis.Spec.RestoreFrom = &cachev1alpha1.RedisRestoreSource{BackupName: "nightly"}
+	r := newFakeReconciler(t, redis, backup)
+
+	// Act
+	_, err := r.resolveRestoreSource(context.Background(), redis)
+
+	// Assert
+	var restoreErr *restoreError
+	assert.ErrorAs(t, err, &restoreErr, "Running backup should not be restored")
+	assert.Equal(t, "BackupNotCompleted", restoreErr.reason, "Reason should report the backup has not completed")
+
+	// Arrange
+	backup.Status = cachev1alpha1.RedisBackupStatus{Phase: cachev1alpha1.RedisBackupCompleted, Checksum: "sha256:abc"}
+	assert.NoError(t, r.Update(context.Background(), backup))
+
+	// Act
+	source, err := r.resolveRestoreSource(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "resolveRestoreSource should not return an error")
+	assert.Equal(t, "s3://backups/redis/nightly.rdb", source.s3.URL, "Source should be the uploaded RDB file")
+	assert.Equal(t, "minio", source.s3.CredentialsSecret, "Credentials of the backup should be used")
+	assert.Equal(t, "sha256:abc", source.checksum, "Checksum of the backup should be verified")
+}
+
+// TestResolveRestoreSourceWithoutPersistence tests that no source is restored into a data volume that does not persist
+func TestResolveRestoreSourceWithoutPersistence(t *testing.T) {
+	sources := []*cachev1alpha1.RedisRestoreSource{
+		{BackupName: "nightly"},
+		{PVC: &cachev1alpha1.RedisRestorePVCSource{ClaimName: "backups", Path: "nightly.rdb"}},
+		{S3: &cachev1alpha1.RedisRestoreS3Source{Endpoint: "http://minio:9000", URL: "s3://backups/redis/nightly.rdb", CredentialsSecret: "minio"}},
+		{VolumeSnapshotName: "nightly"},
+	}
+	for _, from := range sources {
+		// Arrange
+		redis := newTestRedis()
+		redis.Spec.RestoreFrom = from
+		redis.Spec.Persistence = &cachev1alpha1.RedisPersistence{Mode: cachev1alpha1.RedisPersistenceNone}
+		r := newFakeReconciler(t, redis)
+
+		// Act
+		_, err := r.resolveRestoreSource(context.Background(), redis)
+
+		// Assert
+		var restoreErr *restoreError
+		assert.ErrorAs(t, err, &restoreErr, "Restore without persistence should be rejected")
+		assert.Equal(t, "UnsupportedMode", restoreErr.reason, "Restore of %s should report the unsupported mode", restoreFromDescription(from))
+	}
+}
+
+// TestAddRestoreToStatefulSet tests that a new StatefulSet seeds its data volume before Redis starts
+func TestAddRestoreToStatefulSet(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.RestoreFrom = &cachev1alpha1.RedisRestoreSource{
+		S3: &cachev1alpha1.RedisRestoreS3Source{Endpoint: "http://minio:9000", URL: "s3://backups/redis/nightly.rdb", CredentialsSecret: "minio"},
+	}
+	r := newTestReconciler(t)
+	statefulSet, err := r.statefulSetForRedis(redis, "redis-secret")
+	assert.NoError(t, err, "statefulSetForRedis should not return an error")
+	source, err := r.resolveRestoreSource(context.Background(), redis)
+	assert.NoError(t, err, "resolveRestoreSource should not return an error")
+
+	// Act
+	err = addRestoreToStatefulSet(statefulSet, redis, source)
+
+	// Assert
+	assert.NoError(t, err, "addRestoreToStatefulSet should not return an error")
+	assert.Equal(t, int32(1), *statefulSet.Spec.Replicas, "Only the primary should run until the restore has completed")
+	initContainers := statefulSet.Spec.Template.Spec.InitContainers
+	assert.Len(t, initContainers, 2, "RDB file should be downloaded then restored")
+	assert.Equal(t, []string{"cp", "--quiet", "target/backups/redis/nightly.rdb", "/restore/nightly.rdb"}, initContainers[0].Command[4:], "RDB file should be downloaded from the bucket")
+	assert.Contains(t, initContainers[1].Env, corev1.EnvVar{Name: "SOURCE", Value: "/restore/nightly.rdb"}, "Downloaded file should be restored")
+	assert.Contains(t, initContainers[1].Env, corev1.EnvVar{Name: "DESTINATION", Value: "/data/dump.rdb"}, "RDB file should be restored to the data directory")
+	assert.True(t, restoring(statefulSet), "StatefulSet should be restoring")
+}
+
+// TestReconcileRestore tests that the restore init containers are removed once the data volume is seeded
+func TestReconcileRestore(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.RestoreFrom = &cachev1alpha1.RedisRestoreSource{
+		PVC: &cachev1alpha1.RedisRestorePVCSource{ClaimName: "backups", Path: "nightly.rdb"},
+	}
+	r := newTestReconciler(t)
+	statefulSet, err := r.statefulSetForRedis(redis, "redis-secret")
+	assert.NoError(t, err, "statefulSetForRedis should not return an error")
+	assert.NoError(t, addRestoreToStatefulSet(statefulSet, redis, &restoreSource{pvc: redis.Spec.RestoreFrom.PVC}))
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis-0", Namespace: "default"},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{
+				Name:  restoreContainerName,
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Message: "Checksum mismatch"}},
+			}},
+		},
+	}
+	r = newFakeReconciler(t, redis, statefulSet, pod)
+
+	// Act
+	inProgress, err := r.reconcileRestore(context.Background(), redis, statefulSet)
+
+	// Assert
+	assert.NoError(t, err, "reconcileRestore should not return an error")
+	assert.True(t, inProgress, "Failed restore should block the instance")
+	condition := meta.FindStatusCondition(redis.Status.Conditions, typeRestoredRedis)
+	assert.Equal(t, "RestoreFailed", condition.Reason, "Failure should be reported")
+	assert.Contains(t, condition.Message, "Checksum mismatch", "Failure should include the termination message")
+
+	// Arrange
+	pod.Status.InitContainerStatuses[0].State.Terminated.ExitCode = 0
+	assert.NoError(t, r.Status().Update(context.Background(), pod))
+
+	// Act
+	inProgress, err = r.reconcileRestore(context.Background(), redis, statefulSet)
+
+	// Assert
+	assert.NoError(t, err, "reconcileRestore should not return an error")
+	assert.False(t, inProgress, "Restore should have completed")
+	assert.False(t, restoring(statefulSet), "Restore init containers should be removed")
+	for _, volume := range statefulSet.Spec.Template.Spec.Volumes {
+		assert.NotEqual(t, restoreVolumeName, volume.Name, "Restore volume should be removed")
+	}
+	assert.True(t, meta.IsStatusConditionTrue(redis.Status.Conditions, typeRestoredRedis), "Restored condition should be set")
+}
+
+// TestResolveRestoreSourceFromVolumeSnapshot tests that a VolumeSnapshot is only restored once ready and large enough
+func TestResolveRestoreSourceFromVolumeSnapshot(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.RestoreFrom = &cachev1alpha1.RedisRestoreSource{VolumeSnapshotName: "nightly-data-old-redis-0"}
+	snapshot := newReadyVolumeSnapshot(t, "nightly-data-old-redis-0", false, "1Gi")
+	r := newFakeReconciler(t, redis)
+	assert.NoError(t, r.Create(context.Background(), snapshot))
+
+	// Act
+	_, err := r.resolveRestoreSource(context.Background(), redis)
+
+	// Assert
+	var restoreErr *restoreError
+	assert.ErrorAs(t, err, &restoreErr, "Pending snapshot should not be restored")
+	assert.Equal(t, "SnapshotNotReady", restoreErr.reason, "Reason should report the snapshot is not ready")
+
+	// Arrange
+	assert.NoError(t, unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse"))
+	assert.NoError(t, unstructured.SetNestedField(snapshot.Object, "2Gi", "status", "restoreSize"))
+	assert.NoError(t, r.Update(context.Background(), snapshot))
+
+	// Act
+	_, err = r.resolveRestoreSource(context.Background(), redis)
+
+	// Assert
+	assert.ErrorAs(t, err, &restoreErr, "Snapshot larger than the data volume should not be restored")
+	assert.Equal(t, "SnapshotTooLarge", restoreErr.reason, "Reason should report the snapshot is too large")
+
+	// Arrange
+	redis.Spec.Storage.Size = "2Gi"
+
+	// Act
+	source, err := r.resolveRestoreSource(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "resolveRestoreSource should not return an error")
+	assert.Equal(t, "nightly-data-old-redis-0", source.volumeSnapshot, "Source should be the snapshot")
+}
+
+// TestProvisionFromVolumeSnapshot tests that the data volume of the first pod is provisioned from the snapshot
+func TestProvisionFromVolumeSnapshot(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.RestoreFrom = &cachev1alpha1.RedisRestoreSource{VolumeSnapshotName: "nightly-data-old-redis-0"}
+	redis.Spec.Storage.StorageClassName = "csi-fast"
+	r := newFakeReconciler(t, redis)
+
+	// Act
+	provisioned, err := r.provisionFromVolumeSnapshot(context.Background(), redis, "nightly-data-old-redis-0")
+	again, againErr := r.provisionFromVolumeSnapshot(context.Background(), redis, "nightly-data-old-redis-0")
+
+	// Assert
+	assert.NoError(t, err, "provisionFromVolumeSnapshot should not return an error")
+	assert.True(t, provisioned, "Claim should be provisioned from the snapshot")
+	assert.NoError(t, againErr)
+	assert.True(t, again, "Claim provisioned before from the snapshot should be reported as provisioned")
+	claim := &corev1.PersistentVolumeClaim{}
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "data-test-redis-0", Namespace: "default"}, claim), "Claim of the first pod should be created")
+	assert.Equal(t, "VolumeSnapshot", claim.Spec.DataSource.Kind, "Claim should be provisioned from a snapshot")
+	assert.Equal(t, "nightly-data-old-redis-0", claim.Spec.DataSource.Name, "Claim should be provisioned from the snapshot")
+	assert.Equal(t, "csi-fast", *claim.Spec.StorageClassName, "Claim should use the StorageClass of the instance")
+	assert.Equal(t, labelsForRedis(redis), claim.Labels, "Claim should be labelled like the StatefulSet claims")
+}
+
+// TestProvisionFromVolumeSnapshotExistingClaim tests that an existing data volume claim is not reported as restored
+func TestProvisionFromVolumeSnapshotExistingClaim(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.RestoreFrom = &cachev1alpha1.RedisRestoreSource{VolumeSnapshotName: "nightly-data-old-redis-0"}
+	retained := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data-test-redis-0", Namespace: "default"}}
+	r := newFakeReconciler(t, redis, retained)
+
+	// Act
+	provisioned, err := r.provisionFromVolumeSnapshot(context.Background(), redis, "nightly-data-old-redis-0")
+
+	// Assert
+	assert.NoError(t, err, "provisionFromVolumeSnapshot should not return an error")
+	assert.False(t, provisioned, "Existing claim should not be reported as provisioned from the snapshot")
+	claim := &corev1.PersistentVolumeClaim{}
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "data-test-redis-0", Namespace: "default"}, claim))
+	assert.Nil(t, claim.Spec.DataSource, "Existing claim should be left untouched")
+}
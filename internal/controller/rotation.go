@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// rotatePasswordAnnotation requests a password rotation on the Redis instance whenever its value changes
+	rotatePasswordAnnotation = "cache.tc/rotate-password"
+	// rotationTriggerAnnotation records on the Secret the rotate-password value handled last
+	rotationTriggerAnnotation = "cache.tc/rotation-trigger"
+	// passwordRotatedAtAnnotation records on the Secret when the last rotation completed
+	passwordRotatedAtAnnotation = "cache.tc/password-rotated-at"
+	// previousPasswordExpiresAtAnnotation records on the Secret when the previous password is revoked
+	previousPasswordExpiresAtAnnotation = "cache.tc/previous-password-expires-at"
+	// defaultRotationGracePeriod is the grace period when spec.passwordRotation does not set one
+	defaultRotationGracePeriod = 5 * time.Minute
+)
+
+// previousSecretKey returns the key of the Secret holding the previous password while a rotation is in progress
+func previousSecretKey(redis *cachev1alpha1.Redis) string {
+	return secretKeyForRedis(redis) + "-previous"
+}
+
+// rotationGracePeriod returns the time during which the previous password is still accepted
+func rotationGracePeriod(redis *cachev1alpha1.Redis) time.Duration {
+	if rotation := redis.Spec.PasswordRotation; rotation != nil && rotation.GracePeriod.Duration > 0 {
+		return rotation.GracePeriod.Duration
+	}
+	return defaultRotationGracePeriod
+}
+
+// passwordRotationDue reports whether a rotation of the password stored in the Secret has to
+// start, either because it was requested through the rotate-password annotation or because
+// the rotation interval elapsed. Otherwise it returns the time until the next scheduled
+// rotation, or zero when none is scheduled.
+func passwordRotationDue(redis *cachev1alpha1.Redis, secret *corev1.Secret, now time.Time) (bool, time.Duration) {
+	if trigger := redis.Annotations[rotatePasswordAnnotation]; trigger != "" && trigger != secret.Annotations[rotationTriggerAnnotation] {
+		return true, 0
+	}
+
+	rotation := redis.Spec.PasswordRotation
+	if rotation == nil || rotation.Interval == nil || rotation.Interval.Duration <= 0 {
+		return false, 0
+	}
+	last := secret.CreationTimestamp.Time
+	if rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[passwordRotatedAtAnnotation]); err == nil {
+		last = rotatedAt
+	}
+	next := last.Add(rotation.Interval.Duration)
+	if !now.Before(next) {
+		return true, 0
+	}
+	return false, next.Sub(now)
+}
+
+// passwordRotationStatus returns the rotation state recorded on the Secret
+func passwordRotationStatus(redis *cachev1alpha1.Redis, secret *corev1.Secret) *cachev1alpha1.RedisPasswordRotationStatus {
+	status := &cachev1alpha1.RedisPasswordRotationStatus{}
+	if rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[passwordRotatedAtAnnotation]); err == nil {
+		lastRotationTime := metav1.NewTime(rotatedAt)
+		status.LastRotationTime = &lastRotationTime
+	}
+	if _, rotating := secret.Data[previousSecretKey(redis)]; rotating {
+		if expiresAt, err := time.Parse(time.RFC3339, secret.Annotations[previousPasswordExpiresAtAnnotation]); err == nil {
+			expiryTime := metav1.NewTime(expiresAt)
+			status.PreviousPasswordExpiryTime = &expiryTime
+		}
+	}
+	if status.LastRotationTime == nil && status.PreviousPasswordExpiryTime == nil {
+		return nil
+	}
+	return status
+}
+
+// reconcilePasswordRotation rotates the generated password without downtime. A rotation
+// stores the new password in the Secret next to the previous one and makes every Redis
+// server accept both through the ACL of the default user, so clients can pick up the new
+// password from the Secret during the grace period. Once it ends the previous password is
+// revoked and removed from the Secret. The state of the rotation lives on the Secret, so an
+// interrupted rotation is resumed. It returns the password to connect with and the time
+// until the next rotation step, or zero when none is scheduled.
+func (r *RedisReconciler) reconcilePasswordRotation(ctx context.Context, redis *cachev1alpha1.Redis, password string) (string, time.Duration, error) {
+	logger := log.FromContext(ctx)
+
+	// User-supplied Secrets are rotated by their owner
+	if redis.Spec.SecretName != "" {
+		redis.Status.PasswordRotation = nil
+		return password, 0, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: managedSecretName(redis), Namespace: redis.Namespace}, secret); err != nil {
+		return "", 0, err
+	}
+	key := secretKeyForRedis(redis)
+	previousKey := previousSecretKey(redis)
+	now := time.Now()
+
+	if _, rotating := secret.Data[previousKey]; !rotating {
+		due, next := passwordRotationDue(redis, secret, now)
+		if !due {
+			redis.Status.PasswordRotation = passwordRotationStatus(redis, secret)
+			return password, next, nil
+		}
+
+		length, characters := passwordPolicyForRedis(redis)
+		newPassword, err := generateRandomPassword(length, characters)
+		if err != nil {
+			return "", 0, err
+		}
+		logger.Info("Rotating Redis password", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name, "GracePeriod", rotationGracePeriod(redis))
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[rotationTriggerAnnotation] = redis.Annotations[rotatePasswordAnnotation]
+		secret.Annotations[previousPasswordExpiresAtAnnotation] = now.Add(rotationGracePeriod(redis)).UTC().Format(time.RFC3339)
+		secret.Data[previousKey] = secret.Data[key]
+		secret.Data[key] = []byte(newPassword)
+		if err := r.Update(ctx, secret); err != nil {
+			logger.Error(err, "Failed to update Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return "", 0, err
+		}
+	}
+
+	current := string(secret.Data[key])
+	previous := string(secret.Data[previousKey])
+	expiresAt, err := time.Parse(time.RFC3339, secret.Annotations[previousPasswordExpiresAtAnnotation])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid %s annotation on Secret %s: %w", previousPasswordExpiresAtAnnotation, secret.Name, err)
+	}
+
+	// Accept both passwords until the grace period ends
+	if now.Before(expiresAt) {
+		if err := r.setRedisPasswords(ctx, redis, current, previous, true); err != nil {
+			return "", 0, err
+		}
+		redis.Status.PasswordRotation = passwordRotationStatus(redis, secret)
+		return current, expiresAt.Sub(now), nil
+	}
+
+	if err := r.setRedisPasswords(ctx, redis, current, previous, false); err != nil {
+		return "", 0, err
+	}
+	delete(secret.Data, previousKey)
+	delete(secret.Annotations, previousPasswordExpiresAtAnnotation)
+	secret.Annotations[passwordRotatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	// Rotations requested while this one was in progress are served by it
+	secret.Annotations[rotationTriggerAnnotation] = redis.Annotations[rotatePasswordAnnotation]
+	if err := r.Update(ctx, secret); err != nil {
+		logger.Error(err, "Failed to update Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		return "", 0, err
+	}
+	logger.Info("Revoked previous Redis password", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+
+	redis.Status.PasswordRotation = passwordRotationStatus(redis, secret)
+	_, next := passwordRotationDue(redis, secret, now)
+	return current, next, nil
+}
+
+// setRedisPasswords makes every running Redis server accept the current password, and the
+// previous one as well while keepPrevious is set, and authenticate to its primary with the
+// current one. The Sentinels are pointed at the current password too.
+func (r *RedisReconciler) setRedisPasswords(ctx context.Context, redis *cachev1alpha1.Redis, current, previous string, keepPrevious bool) error {
+	pods, err := listRedisPods(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{"ACL", "SETUSER", "default", "on", "resetpass", ">" + current}
+	if keepPrevious {
+		args = append(args, ">"+previous)
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		// Servers the rotation has not reached yet only know the previous password
+		rdb, err := connectRedisPod(ctx, pod, tlsConfig, current, previous)
+		if err != nil {
+			return fmt.Errorf("connect to %s: %w", pod.Name, err)
+		}
+		err = rdb.Do(ctx, args...).Err()
+		if err == nil {
+			err = rdb.ConfigSet(ctx, "masterauth", current).Err()
+		}
+		rdb.Close()
+		if err != nil {
+			return fmt.Errorf("set passwords on %s: %w", pod.Name, err)
+		}
+	}
+
+	if sentinelEnabled(redis) {
+		return r.setSentinelAuthPass(ctx, redis, current)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TestPasswordRotationDue tests when a password rotation starts
+func TestPasswordRotationDue(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	redis := &cachev1alpha1.Redis{}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+		},
+	}
+
+	due, next := passwordRotationDue(redis, secret, now)
+	assert.False(t, due, "Password should not rotate without a policy or request")
+	assert.Zero(t, next, "No rotation should be scheduled")
+
+	redis.Spec.PasswordRotation = &cachev1alpha1.RedisPasswordRotation{
+		Interval: &metav1.Duration{Duration: 2 * time.Hour},
+	}
+	due, next = passwordRotationDue(redis, secret, now)
+	assert.False(t, due, "Password should not rotate before the interval elapsed")
+	assert.Equal(t, time.Hour, next, "Rotation should be scheduled one interval after the Secret was created")
+
+	secret.Annotations = map[string]string{passwordRotatedAtAnnotation: now.Add(-3 * time.Hour).Format(time.RFC3339)}
+	due, _ = passwordRotationDue(redis, secret, now)
+	assert.True(t, due, "Password should rotate once the interval elapsed since the last rotation")
+
+	redis.Spec.PasswordRotation = nil
+	redis.Annotations = map[string]string{rotatePasswordAnnotation: "2024-q2"}
+	due, _ = passwordRotationDue(redis, secret, now)
+	assert.True(t, due, "Password should rotate on request")
+
+	secret.Annotations[rotationTriggerAnnotation] = "2024-q2"
+	due, _ = passwordRotationDue(redis, secret, now)
+	assert.False(t, due, "A request should only be served once")
+}
+
+// TestReconcilePasswordRotation tests that both passwords are kept during the grace period and the previous one is revoked afterwards
+func TestReconcilePasswordRotation(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-redis",
+			Namespace:   "default",
+			Annotations: map[string]string{rotatePasswordAnnotation: "now"},
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			PasswordRotation: &cachev1alpha1.RedisPasswordRotation{
+				GracePeriod: metav1.Duration{Duration: 10 * time.Minute},
+			},
+		},
+	}
+	r := newFakeReconciler(t, redis)
+	ctx := context.Background()
+	secretName, oldPassword, err := r.reconcileSecret(ctx, redis)
+	assert.NoError(t, err, "reconcileSecret should not return an error")
+
+	// Act
+	password, requeueAfter, err := r.reconcilePasswordRotation(ctx, redis, oldPassword)
+
+	// Assert
+	assert.NoError(t, err, "reconcilePasswordRotation should not return an error")
+	assert.NotEqual(t, oldPassword, password, "A new password should be generated")
+	assert.InDelta(t, 10*time.Minute, requeueAfter, float64(time.Minute), "Previous password should be revoked after the grace period")
+
+	secret := &corev1.Secret{}
+	assert.NoError(t, r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: "default"}, secret))
+	assert.Equal(t, password, string(secret.Data["password"]), "Secret should hold the new password")
+	assert.Equal(t, oldPassword, string(secret.Data["password-previous"]), "Secret should keep the previous password during the grace period")
+	assert.NotNil(t, redis.Status.PasswordRotation.PreviousPasswordExpiryTime, "Status should report when the previous password expires")
+
+	// Act
+	secret.Annotations[previousPasswordExpiresAtAnnotation] = time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	assert.NoError(t, r.Update(ctx, secret))
+	current, requeueAfter, err := r.reconcilePasswordRotation(ctx, redis, password)
+
+	// Assert
+	assert.NoError(t, err, "reconcilePasswordRotation should not return an error")
+	assert.Equal(t, password, current, "New password should stay in use")
+	assert.Zero(t, requeueAfter, "No further rotation should be scheduled")
+	assert.NoError(t, r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: "default"}, secret))
+	assert.NotContains(t, secret.Data, "password-previous", "Previous password should be removed from the Secret")
+	assert.NotNil(t, redis.Status.PasswordRotation.LastRotationTime, "Status should report the completed rotation")
+	assert.Nil(t, redis.Status.PasswordRotation.PreviousPasswordExpiryTime, "No previous password should be pending")
+}
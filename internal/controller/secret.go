@@ -1,15 +1,88 @@
 package controller
 
 import (
-	"encoding/base64"
-	"math/rand"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
 
 	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+const (
+	// defaultSecretKey is the key of the Redis password in the Secret when spec.secretKey is not set
+	defaultSecretKey = "password"
+	// defaultPasswordLength is the length of generated passwords when spec.passwordPolicy is not set
+	defaultPasswordLength = 32
+
+	alphanumericCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	// symbolCharacters excludes quotes, backslashes, '$', '#' and whitespace, which would need
+	// escaping in the startup scripts and configuration files the password is written to
+	symbolCharacters = "-_.~+=@%^*:,!"
+)
+
+// managedSecretName returns the name of the Secret generated by the operator
+func managedSecretName(redis *cachev1alpha1.Redis) string {
+	return redis.Name + "-secret"
+}
+
+// secretNameForRedis returns the name of the Secret holding the Redis password, which is
+// either the Secret supplied by the user or the one generated by the operator
+func secretNameForRedis(redis *cachev1alpha1.Redis) string {
+	if redis.Spec.SecretName != "" {
+		return redis.Spec.SecretName
+	}
+	return managedSecretName(redis)
+}
+
+// secretKeyForRedis returns the key of the Redis password in the Secret
+func secretKeyForRedis(redis *cachev1alpha1.Redis) string {
+	if redis.Spec.SecretKey != "" {
+		return redis.Spec.SecretKey
+	}
+	return defaultSecretKey
+}
+
+// passwordPolicyForRedis returns the length and characters of the generated password
+func passwordPolicyForRedis(redis *cachev1alpha1.Redis) (int, string) {
+	length := defaultPasswordLength
+	characters := alphanumericCharacters
+	if policy := redis.Spec.PasswordPolicy; policy != nil {
+		if policy.Length > 0 {
+			length = int(policy.Length)
+		}
+		if policy.Charset == cachev1alpha1.RedisPasswordCharsetSymbols {
+			characters += symbolCharacters
+		}
+	}
+	return length, characters
+}
+
+// credentialsError reports why the Redis password could not be resolved. Its reason is
+// surfaced in the CredentialsReady condition. A nil cause means the user-supplied Secret or
+// key is missing, which is retried once the Secret changes rather than with a backoff.
+type credentialsError struct {
+	reason  string
+	message string
+	cause   error
+}
+
+func (e *credentialsError) Error() string {
+	return e.message
+}
+
+func (e *credentialsError) Unwrap() error {
+	return e.cause
+}
+
 // createSecret creates a new Kubernetes Secret for storing the Redis password
 func (r *RedisReconciler) createSecret(redis *cachev1alpha1.Redis, password string) (*corev1.Secret, error) {
 	labels := map[string]string{
@@ -17,12 +90,12 @@ func (r *RedisReconciler) createSecret(redis *cachev1alpha1.Redis, password stri
 	}
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      redis.Name + "-secret",
+			Name:      managedSecretName(redis),
 			Namespace: redis.Namespace,
 			Labels:    labels,
 		},
 		Data: map[string][]byte{
-			"password": []byte(base64.StdEncoding.EncodeToString([]byte(password))),
+			secretKeyForRedis(redis): []byte(password),
 		},
 	}
 	// Set Redis instance as the owner of the Secret
@@ -33,12 +106,94 @@ func (r *RedisReconciler) createSecret(redis *cachev1alpha1.Redis, password stri
 	return secret, nil
 }
 
-// generateRandomPassword creates a secure random password
-func generateRandomPassword() (string, error) {
-	bytePassword := make([]byte, 16) // Adjust length as needed
-	_, err := rand.Read(bytePassword)
-	if err != nil {
-		return "", err
+// reconcileSecret returns the name of the Secret holding the Redis password together with
+// the password. A Secret supplied through spec.secretName is only read; otherwise the
+// operator generates the Secret when it does not exist yet. A missing user-supplied Secret
+// or key is reported as a credentialsError.
+func (r *RedisReconciler) reconcileSecret(ctx context.Context, redis *cachev1alpha1.Redis) (string, string, error) {
+	logger := log.FromContext(ctx)
+	secretName := secretNameForRedis(redis)
+	secretKey := secretKeyForRedis(redis)
+
+	foundSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: redis.Namespace}, foundSecret)
+	if err != nil && errors.IsNotFound(err) {
+		if redis.Spec.SecretName != "" {
+			return "", "", &credentialsError{
+				reason:  "SecretNotFound",
+				message: fmt.Sprintf("Secret %s not found", secretName),
+			}
+		}
+
+		// Secret not found, create a new one
+		length, characters := passwordPolicyForRedis(redis)
+		redisPassword, err := generateRandomPassword(length, characters)
+		if err != nil {
+			return "", "", &credentialsError{
+				reason:  "PasswordGenerationFailed",
+				message: fmt.Sprintf("Failed to generate the Redis password: %v", err),
+				cause:   err,
+			}
+		}
+		secret, err := r.createSecret(redis, redisPassword)
+		if err != nil {
+			return "", "", err
+		}
+
+		logger.Info("Creating a new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		err = r.Create(ctx, secret)
+		if err != nil {
+			logger.Error(err, "Failed to create new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return "", "", err
+		}
+		foundSecret = secret
+	} else if err != nil {
+		logger.Error(err, "Failed to get Secret")
+		return "", "", err
+	}
+
+	password, found := foundSecret.Data[secretKey]
+	if !found || len(password) == 0 {
+		return "", "", &credentialsError{
+			reason:  "SecretKeyNotFound",
+			message: fmt.Sprintf("Secret %s has no password under key %s", secretName, secretKey),
+		}
+	}
+	return secretName, string(password), nil
+}
+
+// redisForSecret maps a Secret to the Redis instances of its namespace that read their
+// password or TLS certificate from it, so that they are reconciled when a user-supplied or
+// cert-manager issued Secret changes
+func (r *RedisReconciler) redisForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	redisList := &cachev1alpha1.RedisList{}
+	if err := r.List(ctx, redisList, client.InNamespace(secret.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Redis instances for Secret", "Secret.Namespace", secret.GetNamespace(), "Secret.Name", secret.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, redis := range redisList.Items {
+		if redis.Spec.SecretName == secret.GetName() || (tlsEnabled(&redis) && tlsSecretName(&redis) == secret.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// generateRandomPassword returns a password of the given length drawn uniformly from the
+// given characters using a cryptographically secure random source
+func generateRandomPassword(length int, characters string) (string, error) {
+	count := big.NewInt(int64(len(characters)))
+	password := make([]byte, length)
+	for i := range password {
+		index, err := rand.Int(rand.Reader, count)
+		if err != nil {
+			return "", err
+		}
+		password[i] = characters[index.Int64()]
 	}
-	return base64.URLEncoding.EncodeToString(bytePassword), nil
+	return string(password), nil
 }
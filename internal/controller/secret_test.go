@@ -1,12 +1,19 @@
 package controller
 
 import (
-	"encoding/base64"
+	"context"
+	"strings"
 	"testing"
 
 	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 // TestCreateSecret tests the createSecret function
@@ -21,7 +28,7 @@ func TestCreateSecret(t *testing.T) {
 
 	password := "mysecurepassword"
 
-	r := &RedisReconciler{}
+	r := newTestReconciler(t)
 
 	// Act
 	secret, _ := r.createSecret(redis, password)
@@ -30,21 +37,174 @@ func TestCreateSecret(t *testing.T) {
 	assert.Equal(t, redis.Namespace, secret.Namespace, "Secret namespace should match")
 	assert.Equal(t, redis.Name, secret.Labels["app"], "Secret label 'app' should match Redis name")
 
-	encodedPassword := base64.StdEncoding.EncodeToString([]byte(password))
-	assert.Equal(t, encodedPassword, string(secret.Data["password"]), "Secret password should be base64 encoded")
+	assert.Equal(t, password, string(secret.Data["password"]), "Secret should hold the password itself")
 }
 
 // TestGenerateRandomPassword tests the generateRandomPassword function
 func TestGenerateRandomPassword(t *testing.T) {
 	// Act
-	password, err := generateRandomPassword()
+	password, err := generateRandomPassword(32, alphanumericCharacters)
 
 	// Assert
 	assert.NoError(t, err, "generateRandomPassword should not return an error")
-	assert.NotEmpty(t, password, "Generated password should not be empty")
+	assert.Len(t, password, 32, "Generated password should have the requested length")
+	for _, c := range password {
+		assert.True(t, strings.ContainsRune(alphanumericCharacters, c), "Generated password should only use the requested characters")
+	}
+
+	other, err := generateRandomPassword(32, alphanumericCharacters)
+	assert.NoError(t, err, "generateRandomPassword should not return an error")
+	assert.NotEqual(t, password, other, "Generated passwords should differ")
+}
+
+// TestPasswordPolicyForRedis tests the length and characters of generated passwords
+func TestPasswordPolicyForRedis(t *testing.T) {
+	redis := &cachev1alpha1.Redis{}
+
+	length, characters := passwordPolicyForRedis(redis)
+	assert.Equal(t, 32, length, "Password length should default to 32")
+	assert.Equal(t, alphanumericCharacters, characters, "Password should default to alphanumeric characters")
+
+	redis.Spec.PasswordPolicy = &cachev1alpha1.RedisPasswordPolicy{
+		Length:  64,
+		Charset: cachev1alpha1.RedisPasswordCharsetSymbols,
+	}
+	length, characters = passwordPolicyForRedis(redis)
+	assert.Equal(t, 64, length, "Password length should match the policy")
+	assert.Contains(t, characters, "@", "Symbols charset should include symbols")
+	assert.NotContains(t, characters, "$", "Symbols charset should exclude shell expansion characters")
+}
+
+// TestReconcileSecretGenerated tests that a Secret is generated when spec.secretName is not set
+func TestReconcileSecretGenerated(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+	}
+	r := newFakeReconciler(t, redis)
+
+	// Act
+	secretName, password, err := r.reconcileSecret(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "reconcileSecret should not return an error")
+	assert.Equal(t, "test-redis-secret", secretName, "Generated Secret should be named after the Redis instance")
+	assert.NotEmpty(t, password, "Generated password should be returned")
+
+	secret := &corev1.Secret{}
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: secretName, Namespace: "default"}, secret), "Generated Secret should be created")
+	assert.True(t, metav1.IsControlledBy(secret, redis), "Generated Secret should be owned by the Redis instance")
+}
+
+// TestReconcileSecretUserSupplied tests that a user-supplied Secret and key are read without being owned
+func TestReconcileSecretUserSupplied(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			SecretName: "redis-credentials",
+			SecretKey:  "redis-password",
+		},
+	}
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "redis-credentials",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{"redis-password": []byte("s3cret")},
+	}
+	r := newFakeReconciler(t, redis, userSecret)
 
-	// Check that the password can be decoded from base64
-	decodedPassword, err := base64.URLEncoding.DecodeString(password)
-	assert.NoError(t, err, "Generated password should be valid base64")
-	assert.Len(t, decodedPassword, 16, "Decoded password should be 16 bytes long")
+	// Act
+	secretName, password, err := r.reconcileSecret(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "reconcileSecret should not return an error")
+	assert.Equal(t, "redis-credentials", secretName, "User-supplied Secret should be used")
+	assert.Equal(t, "s3cret", password, "Password should be read from the configured key")
+
+	err = r.Get(context.Background(), types.NamespacedName{Name: "test-redis-secret", Namespace: "default"}, &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err), "No Secret should be generated")
+
+	// Deleting the instance leaves the user-supplied Secret untouched
+	assert.NoError(t, r.deleteDependantResources(context.Background(), redis), "deleteDependantResources should not return an error")
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "redis-credentials", Namespace: "default"}, &corev1.Secret{}), "User-supplied Secret should not be deleted")
+}
+
+// TestReconcileSecretMissing tests that a missing user-supplied Secret or key is reported
+func TestReconcileSecretMissing(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			SecretName: "redis-credentials",
+		},
+	}
+	r := newFakeReconciler(t, redis)
+
+	// Act
+	_, _, err := r.reconcileSecret(context.Background(), redis)
+
+	// Assert
+	var credentialsErr *credentialsError
+	assert.ErrorAs(t, err, &credentialsErr, "Missing Secret should be reported")
+	assert.Equal(t, "SecretNotFound", credentialsErr.reason, "Reason should name the missing Secret")
+
+	// Act
+	assert.NoError(t, r.Create(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"other": []byte("value")},
+	}))
+	_, _, err = r.reconcileSecret(context.Background(), redis)
+
+	// Assert
+	assert.ErrorAs(t, err, &credentialsErr, "Missing key should be reported")
+	assert.Equal(t, "SecretKeyNotFound", credentialsErr.reason, "Reason should name the missing key")
+}
+
+// TestDeleteDependantResourcesOwnership tests that deleting the instance only deletes the objects it controls
+func TestDeleteDependantResourcesOwnership(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.UID = "test-redis-uid"
+	owned := []client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: configMapName(redis), Namespace: "default"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"}},
+	}
+	foreign := []client.Object{
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: headlessServiceName(redis), Namespace: "default"}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: sentinelName(redis), Namespace: "default"}},
+	}
+	r := newFakeReconciler(t, redis)
+	for _, obj := range owned {
+		assert.NoError(t, controllerutil.SetControllerReference(redis, obj, r.Scheme))
+		assert.NoError(t, r.Create(context.Background(), obj))
+	}
+	for _, obj := range foreign {
+		assert.NoError(t, r.Create(context.Background(), obj))
+	}
+
+	// Act
+	err := r.deleteDependantResources(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "deleteDependantResources should not return an error")
+	for _, obj := range owned {
+		getErr := r.Get(context.Background(), client.ObjectKeyFromObject(obj), obj)
+		assert.True(t, errors.IsNotFound(getErr), "%T %s owned by the instance should be deleted", obj, obj.GetName())
+	}
+	for _, obj := range foreign {
+		getErr := r.Get(context.Background(), client.ObjectKeyFromObject(obj), obj)
+		assert.NoError(t, getErr, "%T %s not owned by the instance should not be deleted", obj, obj.GetName())
+	}
 }
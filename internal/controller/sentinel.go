@@ -0,0 +1,419 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// sentinelPort is the port Redis Sentinel listens on inside the pod
+	sentinelPort = 26379
+	// sentinelMasterName is the name the Sentinels monitor the primary under
+	sentinelMasterName = "mymaster"
+	// sentinelConfigDir holds the configuration file Sentinel rewrites at runtime
+	sentinelConfigDir = "/sentinel"
+	// sentinelPollInterval is how often the operator asks the Sentinels for the current primary
+	sentinelPollInterval = 15 * time.Second
+)
+
+// sentinelName returns the name of the Sentinel StatefulSet and its governing Service
+func sentinelName(redis *cachev1alpha1.Redis) string {
+	return redis.Name + "-sentinel"
+}
+
+// sentinelEnabled reports whether a Sentinel quorum should monitor the Redis instance.
+// Redis Cluster handles failover itself, so Sentinel only applies to replication mode.
+func sentinelEnabled(redis *cachev1alpha1.Redis) bool {
+	return redis.Spec.Sentinel != nil && !isClusterMode(redis)
+}
+
+// labelsForSentinel returns the labels selecting the Sentinel pods of the given Redis instance
+func labelsForSentinel(redis *cachev1alpha1.Redis) map[string]string {
+	return map[string]string{
+		"app": sentinelName(redis),
+	}
+}
+
+// sentinelStartupScript returns the shell script writing the Sentinel configuration and
+// starting redis-sentinel. A Sentinel joining an existing quorum monitors the primary the
+// other Sentinels agreed on, otherwise it starts monitoring the first Redis pod. With TLS
+// enabled the Sentinels talk to each other and to Redis over TLS.
+func sentinelStartupScript(redis *cachev1alpha1.Redis) string {
+	sentinel := redis.Spec.Sentinel
+	return fmt.Sprintf(`set -e
+%[11]sPRIMARY="%[1]s"
+ELECTED=$(redis-cli%[12]s -h %[2]s -p %[3]d SENTINEL get-master-addr-by-name %[4]s 2>/dev/null | head -n 1 || true)
+if [ -n "${ELECTED}" ]; then
+  PRIMARY="${ELECTED}"
+fi
+cat > %[5]s/sentinel.conf <<EOF
+%[13]ssentinel resolve-hostnames yes
+sentinel announce-hostnames yes
+sentinel announce-ip ${HOSTNAME}.%[2]s.%[6]s.svc
+sentinel monitor %[4]s ${PRIMARY} %[7]d %[8]d
+sentinel auth-pass %[4]s "${PASSWORD}"
+sentinel down-after-milliseconds %[4]s %[9]d
+sentinel failover-timeout %[4]s %[10]d
+sentinel parallel-syncs %[4]s 1
+EOF
+exec redis-sentinel %[5]s/sentinel.conf
+`, podHostname(redis, podName(redis, 0)), sentinelName(redis), sentinelServerPort(redis), sentinelMasterName,
+		sentinelConfigDir, redis.Namespace, redisServerPort(redis), sentinel.Quorum,
+		sentinel.DownAfterMilliseconds, sentinel.FailoverTimeoutMilliseconds,
+		passwordScript(), redisCLITLSFlags(redis), renderDirectives(sentinelPortDirectives(redis)))
+}
+
+// sentinelPortDirectives returns the sentinel.conf directives of the ports Sentinel listens
+// on and, with TLS enabled, of the certificate it serves and connects to Redis with
+func sentinelPortDirectives(redis *cachev1alpha1.Redis) map[string]string {
+	directives := map[string]string{"port": strconv.Itoa(sentinelPort)}
+	if !tlsEnabled(redis) {
+		return directives
+	}
+	if redis.Spec.TLS.DisablePlaintext {
+		directives["port"] = "0"
+	}
+	for directive, value := range tlsDirectives(redis) {
+		directives[directive] = value
+	}
+	directives["tls-port"] = strconv.Itoa(sentinelTLSPort)
+	return directives
+}
+
+// sentinelPorts returns the container ports of the Sentinel container
+func sentinelPorts(redis *cachev1alpha1.Redis) []corev1.ContainerPort {
+	ports := []corev1.ContainerPort{}
+	if redisListenPort(redis) != 0 {
+		ports = append(ports, corev1.ContainerPort{Name: "sentinel", ContainerPort: sentinelPort})
+	}
+	if tlsEnabled(redis) {
+		ports = append(ports, corev1.ContainerPort{Name: "sentinel-tls", ContainerPort: sentinelTLSPort})
+	}
+	return ports
+}
+
+// sentinelServicePorts returns the ports of the Sentinel Service, matching the container ports
+func sentinelServicePorts(redis *cachev1alpha1.Redis) []corev1.ServicePort {
+	ports := []corev1.ServicePort{}
+	for _, port := range sentinelPorts(redis) {
+		ports = append(ports, corev1.ServicePort{
+			Name:       port.Name,
+			Port:       port.ContainerPort,
+			TargetPort: intstr.FromString(port.Name),
+		})
+	}
+	return ports
+}
+
+// sentinelVolumeMounts returns the volumes mounted into the Sentinel container
+func sentinelVolumeMounts(redis *cachev1alpha1.Redis) []corev1.VolumeMount {
+	mounts := []corev1.VolumeMount{{
+		Name:      "sentinel-config",
+		MountPath: sentinelConfigDir,
+	}}
+	if tlsEnabled(redis) {
+		mounts = append(mounts, tlsVolumeMount())
+	}
+	return mounts
+}
+
+// sentinelVolumes returns the volumes of the Sentinel pods
+func sentinelVolumes(redis *cachev1alpha1.Redis) []corev1.Volume {
+	volumes := []corev1.Volume{{
+		Name: "sentinel-config",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}}
+	if tlsEnabled(redis) {
+		volumes = append(volumes, tlsVolume(redis))
+	}
+	return volumes
+}
+
+// sentinelServiceForRedis returns the headless Service governing the Sentinel pods.
+// Clients resolve it to discover the Sentinels and ask them for the current primary.
+func (r *RedisReconciler) sentinelServiceForRedis(redis *cachev1alpha1.Redis) (*corev1.Service, error) {
+	labels := labelsForSentinel(redis)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sentinelName(redis),
+			Namespace: redis.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			Ports:     sentinelServicePorts(redis),
+		},
+	}
+	if err := controllerutil.SetControllerReference(redis, service, r.Scheme); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// sentinelStatefulSetForRedis returns the StatefulSet running the Sentinel quorum
+func (r *RedisReconciler) sentinelStatefulSetForRedis(redis *cachev1alpha1.Redis, secretName string) (*appsv1.StatefulSet, error) {
+	labels := labelsForSentinel(redis)
+	replicas := redis.Spec.Sentinel.Replicas
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sentinelName(redis),
+			Namespace: redis.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: sentinelName(redis),
+			// Sentinels do not depend on each other to start
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: tlsPodAnnotations(redis),
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image:   redis.Spec.Image + ":" + redis.Spec.Version,
+						Name:    "sentinel",
+						Command: []string{"sh", "-c", sentinelStartupScript(redis)},
+						Ports:   sentinelPorts(redis),
+						Env: []corev1.EnvVar{
+							{
+								Name: "REDIS_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: secretName,
+										},
+										Key: secretKeyForRedis(redis),
+									},
+								},
+							},
+						},
+						VolumeMounts: sentinelVolumeMounts(redis),
+					}},
+					Volumes: sentinelVolumes(redis),
+				},
+			},
+		},
+	}
+	if err := controllerutil.SetControllerReference(redis, statefulSet, r.Scheme); err != nil {
+		return nil, err
+	}
+	return statefulSet, nil
+}
+
+// reconcileSentinel creates or updates the Sentinel Service and StatefulSet when Sentinel
+// is enabled, and removes them once it has been disabled. status.sentinel records that the
+// quorum was provisioned, so that instances that never ran Sentinel are left alone.
+func (r *RedisReconciler) reconcileSentinel(ctx context.Context, redis *cachev1alpha1.Redis, secretName string) error {
+	logger := log.FromContext(ctx)
+
+	if !sentinelEnabled(redis) {
+		if redis.Status.Sentinel == nil {
+			return nil
+		}
+		if err := r.deleteSentinel(ctx, redis); err != nil {
+			return err
+		}
+		redis.Status.Sentinel = nil
+		return nil
+	}
+	if redis.Status.Sentinel == nil {
+		redis.Status.Sentinel = &cachev1alpha1.RedisSentinelStatus{}
+	}
+
+	// Check if the Sentinel Service already exists, if not create one
+	foundService := &corev1.Service{}
+	err := r.Get(ctx, types.NamespacedName{Name: sentinelName(redis), Namespace: redis.Namespace}, foundService)
+	if err != nil && errors.IsNotFound(err) {
+		svc, err := r.sentinelServiceForRedis(redis)
+		if err != nil {
+			return err
+		}
+		logger.Info("Creating a new Sentinel Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+		if err := r.Create(ctx, svc); err != nil {
+			logger.Error(err, "Failed to create new Sentinel Service", "Service.Namespace", svc.Namespace, "Service.Name", svc.Name)
+			return err
+		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get Sentinel Service")
+		return err
+	} else if desiredService, err := r.sentinelServiceForRedis(redis); err != nil {
+		return err
+	} else if updateServiceSpec(foundService, desiredService) {
+		// The ports change when TLS is enabled or the plaintext port is disabled
+		if err := r.Update(ctx, foundService); err != nil {
+			logger.Error(err, "Failed to update Sentinel Service", "Service.Namespace", foundService.Namespace, "Service.Name", foundService.Name)
+			return err
+		}
+		logger.Info("Updated Sentinel Service", "Service.Namespace", foundService.Namespace, "Service.Name", foundService.Name)
+	}
+
+	desired, err := r.sentinelStatefulSetForRedis(redis, secretName)
+	if err != nil {
+		return err
+	}
+
+	// Check if the Sentinel StatefulSet already exists, if not create one
+	foundStatefulSet := &appsv1.StatefulSet{}
+	err = r.Get(ctx, types.NamespacedName{Name: sentinelName(redis), Namespace: redis.Namespace}, foundStatefulSet)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new Sentinel StatefulSet", "StatefulSet.Namespace", desired.Namespace, "StatefulSet.Name", desired.Name)
+		if err := r.Create(ctx, desired); err != nil {
+			logger.Error(err, "Failed to create new Sentinel StatefulSet", "StatefulSet.Namespace", desired.Namespace, "StatefulSet.Name", desired.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get Sentinel StatefulSet")
+		return err
+	}
+	redis.Status.Sentinel.ReadyReplicas = foundStatefulSet.Status.ReadyReplicas
+
+	// Update the Sentinel size, image, configuration, password Secret and TLS certificate if necessary
+	container := &foundStatefulSet.Spec.Template.Spec.Containers[0]
+	desiredContainer := desired.Spec.Template.Spec.Containers[0]
+	podSpec := &foundStatefulSet.Spec.Template.Spec
+	if *foundStatefulSet.Spec.Replicas != *desired.Spec.Replicas ||
+		container.Image != desiredContainer.Image ||
+		!equality.Semantic.DeepEqual(container.Command, desiredContainer.Command) ||
+		!equality.Semantic.DeepDerivative(desiredContainer.Env, container.Env) ||
+		len(container.Ports) != len(desiredContainer.Ports) || !equality.Semantic.DeepDerivative(desiredContainer.Ports, container.Ports) ||
+		len(podSpec.Volumes) != len(desired.Spec.Template.Spec.Volumes) ||
+		!equality.Semantic.DeepDerivative(desired.Spec.Template.Annotations, foundStatefulSet.Spec.Template.Annotations) {
+		foundStatefulSet.Spec.Replicas = desired.Spec.Replicas
+		container.Image = desiredContainer.Image
+		container.Command = desiredContainer.Command
+		container.Env = desiredContainer.Env
+		container.Ports = desiredContainer.Ports
+		container.VolumeMounts = desiredContainer.VolumeMounts
+		podSpec.Volumes = desired.Spec.Template.Spec.Volumes
+		if foundStatefulSet.Spec.Template.Annotations == nil {
+			foundStatefulSet.Spec.Template.Annotations = map[string]string{}
+		}
+		for key, value := range desired.Spec.Template.Annotations {
+			foundStatefulSet.Spec.Template.Annotations[key] = value
+		}
+		if err := r.Update(ctx, foundStatefulSet); err != nil {
+			logger.Error(err, "Failed to update Sentinel StatefulSet", "StatefulSet.Namespace", foundStatefulSet.Namespace, "StatefulSet.Name", foundStatefulSet.Name)
+			return err
+		}
+		logger.Info("Updated Sentinel StatefulSet", "StatefulSet.Namespace", foundStatefulSet.Namespace, "StatefulSet.Name", foundStatefulSet.Name)
+	}
+
+	return nil
+}
+
+// deleteSentinel removes the Sentinel StatefulSet and Service of the Redis instance, unless
+// they are same-named objects the instance does not control
+func (r *RedisReconciler) deleteSentinel(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	if err := r.deleteOwned(ctx, redis, &appsv1.StatefulSet{}, sentinelName(redis)); err != nil {
+		return err
+	}
+	return r.deleteOwned(ctx, redis, &corev1.Service{}, sentinelName(redis))
+}
+
+// newSentinelClient returns a client connected to the Sentinel running in the given pod,
+// over TLS when a TLS configuration is given
+func newSentinelClient(pod *corev1.Pod, redis *cachev1alpha1.Redis, tlsConfig *tls.Config) *goredis.SentinelClient {
+	return goredis.NewSentinelClient(&goredis.Options{
+		Addr:        net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(sentinelServerPort(redis))),
+		DialTimeout: redisDialTimeout,
+		MaxRetries:  1,
+		TLSConfig:   tlsConfigForPod(tlsConfig, pod),
+	})
+}
+
+// sentinelPrimary asks the running Sentinels for the address of the current primary and
+// returns the name of the Redis pod behind it.
+func (r *RedisReconciler) sentinelPrimary(ctx context.Context, redis *cachev1alpha1.Redis, redisPods []corev1.Pod) (string, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(redis.Namespace), client.MatchingLabels(labelsForSentinel(redis))); err != nil {
+		return "", err
+	}
+
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return "", err
+	}
+
+	var lastErr error = fmt.Errorf("no Sentinel pod is running")
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		sentinel := newSentinelClient(&pod, redis, tlsConfig)
+		addr, err := sentinel.GetMasterAddrByName(ctx, sentinelMasterName).Result()
+		sentinel.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if name := primaryPodForAddress(redis, redisPods, addr[0]); name != "" {
+			return name, nil
+		}
+		lastErr = fmt.Errorf("sentinel primary %s does not match any Redis pod", addr[0])
+	}
+	return "", lastErr
+}
+
+// setSentinelAuthPass points every running Sentinel at the given Redis password
+func (r *RedisReconciler) setSentinelAuthPass(ctx context.Context, redis *cachev1alpha1.Redis, password string) error {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(redis.Namespace), client.MatchingLabels(labelsForSentinel(redis))); err != nil {
+		return err
+	}
+
+	tlsConfig, err := tlsConfigForRedis(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		sentinel := newSentinelClient(&pod, redis, tlsConfig)
+		err := sentinel.Set(ctx, sentinelMasterName, "auth-pass", password).Err()
+		sentinel.Close()
+		if err != nil {
+			return fmt.Errorf("set auth-pass on %s: %w", pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// primaryPodForAddress returns the name of the Redis pod announced under the given hostname or IP
+func primaryPodForAddress(redis *cachev1alpha1.Redis, pods []corev1.Pod, host string) string {
+	for _, pod := range pods {
+		if host == podHostname(redis, pod.Name) || host == pod.Status.PodIP {
+			return pod.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// TestSentinelStatefulSetForRedis tests the sentinelStatefulSetForRedis function
+func TestSentinelStatefulSetForRedis(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			Image:   "redis",
+			Version: "7.2",
+			Sentinel: &cachev1alpha1.RedisSentinel{
+				Replicas:                    3,
+				Quorum:                      2,
+				DownAfterMilliseconds:       5000,
+				FailoverTimeoutMilliseconds: 60000,
+			},
+		},
+	}
+	r := newTestReconciler(t)
+
+	// Act
+	statefulSet, err := r.sentinelStatefulSetForRedis(redis, "redis-secret")
+
+	// Assert
+	assert.NoError(t, err, "sentinelStatefulSetForRedis should not return an error")
+	assert.Equal(t, "test-redis-sentinel", statefulSet.Name, "StatefulSet name should be derived from the Redis name")
+	assert.Equal(t, int32(3), *statefulSet.Spec.Replicas, "StatefulSet replicas should match Sentinel replicas")
+	assert.Equal(t, "redis:7.2", statefulSet.Spec.Template.Spec.Containers[0].Image, "Sentinel should use the Redis image")
+	assert.Equal(t, "test-redis-sentinel", statefulSet.Spec.Template.Labels["app"], "Sentinel pods should not match the Redis selector")
+
+	script := statefulSet.Spec.Template.Spec.Containers[0].Command[2]
+	assert.Contains(t, script, "sentinel monitor mymaster ${PRIMARY} 6379 2", "Sentinel should monitor the primary with the quorum")
+	assert.Contains(t, script, `sentinel auth-pass mymaster "${PASSWORD}"`, "Sentinel should authenticate with the managed password")
+	assert.Contains(t, script, "sentinel down-after-milliseconds mymaster 5000", "Sentinel should use the configured down-after time")
+	assert.Contains(t, script, "sentinel failover-timeout mymaster 60000", "Sentinel should use the configured failover timeout")
+}
+
+// TestPrimaryPodForAddress tests mapping the address reported by Sentinel to a Redis pod
+func TestPrimaryPodForAddress(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+	}
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "test-redis-0"}, Status: corev1.PodStatus{PodIP: "10.0.0.1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "test-redis-1"}, Status: corev1.PodStatus{PodIP: "10.0.0.2"}},
+	}
+
+	assert.Equal(t, "test-redis-1", primaryPodForAddress(redis, pods, "test-redis-1.test-redis-headless.default.svc"), "Hostname should match the pod")
+	assert.Equal(t, "test-redis-0", primaryPodForAddress(redis, pods, "10.0.0.1"), "IP should match the pod")
+	assert.Empty(t, primaryPodForAddress(redis, pods, "10.0.0.3"), "Unknown address should not match")
+}
+
+// TestReconcileSentinelDisabled tests that only a provisioned Sentinel quorum the instance controls is removed
+func TestReconcileSentinelDisabled(t *testing.T) {
+	// Arrange
+	neverProvisioned := newTestRedis()
+	neverProvisioned.UID = "test-redis-uid"
+	provisioned := neverProvisioned.DeepCopy()
+	provisioned.Status.Sentinel = &cachev1alpha1.RedisSentinelStatus{ReadyReplicas: 3}
+	statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "test-redis-sentinel", Namespace: "default"}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test-redis-sentinel", Namespace: "default"}}
+	r := newFakeReconciler(t, service)
+	assert.NoError(t, controllerutil.SetControllerReference(provisioned, statefulSet, r.Scheme))
+	assert.NoError(t, r.Create(context.Background(), statefulSet))
+
+	// Act
+	neverProvisionedErr := r.reconcileSentinel(context.Background(), neverProvisioned, "redis-secret")
+	neverProvisionedGetErr := r.Get(context.Background(), client.ObjectKeyFromObject(statefulSet), &appsv1.StatefulSet{})
+	provisionedErr := r.reconcileSentinel(context.Background(), provisioned, "redis-secret")
+
+	// Assert
+	assert.NoError(t, neverProvisionedErr, "reconcileSentinel should not return an error")
+	assert.NoError(t, neverProvisionedGetErr, "Sentinel should not be removed from an instance that never provisioned it")
+	assert.NoError(t, provisionedErr, "reconcileSentinel should not return an error")
+	getErr := r.Get(context.Background(), client.ObjectKeyFromObject(statefulSet), &appsv1.StatefulSet{})
+	assert.True(t, errors.IsNotFound(getErr), "Sentinel StatefulSet owned by the instance should be removed")
+	assert.NoError(t, r.Get(context.Background(), client.ObjectKeyFromObject(service), &corev1.Service{}), "Sentinel Service not owned by the instance should be kept")
+	assert.Nil(t, provisioned.Status.Sentinel, "Sentinel status should be cleared once the quorum is removed")
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// headlessServiceName returns the name of the Service governing the Redis StatefulSet
+func headlessServiceName(redis *cachev1alpha1.Redis) string {
+	return redis.Name + "-headless"
+}
+
+// servicePortsForRedis returns the ports of the Redis Services: the plaintext port on the given
+// port unless it is disabled, and the TLS port once TLS is enabled
+func servicePortsForRedis(redis *cachev1alpha1.Redis, port int32) []corev1.ServicePort {
+	ports := []corev1.ServicePort{}
+	if redisListenPort(redis) != 0 {
+		ports = append(ports, corev1.ServicePort{
+			Name:       "redis",
+			Port:       port,
+			TargetPort: intstr.FromString("redis"),
+		})
+	}
+	if tlsEnabled(redis) {
+		ports = append(ports, corev1.ServicePort{
+			Name:       "redis-tls",
+			Port:       redisTLSPort,
+			TargetPort: intstr.FromString("redis-tls"),
+		})
+	}
+	return ports
+}
+
+// headlessServiceForRedis returns the headless Service that gives each Redis pod a stable DNS name
+func (r *RedisReconciler) headlessServiceForRedis(redis *cachev1alpha1.Redis) (*corev1.Service, error) {
+	labels := labelsForRedis(redis)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceName(redis),
+			Namespace: redis.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			// Pods must be resolvable before they are ready so that members can find each other
+			PublishNotReadyAddresses: true,
+			Ports:                    servicePortsForRedis(redis, redisPort),
+		},
+	}
+	if err := controllerutil.SetControllerReference(redis, service, r.Scheme); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// selectorForPrimary returns the selector matching only the current primary pod. In cluster
+// mode every pod serves part of the keyspace and redirects clients, so all pods are selected.
+func selectorForPrimary(redis *cachev1alpha1.Redis) map[string]string {
+	selector := labelsForRedis(redis)
+	if !isClusterMode(redis) {
+		selector[appsv1.StatefulSetPodNameLabel] = primaryPodName(redis)
+	}
+	return selector
+}
+
+// serviceForRedis returns the Service clients connect to. In replication mode it always routes
+// to the current primary. Its type, port and annotations are taken from spec.service, while
+// the TLS port is always redisTLSPort.
+func (r *RedisReconciler) serviceForRedis(redis *cachev1alpha1.Redis) (*corev1.Service, error) {
+	serviceType := corev1.ServiceTypeClusterIP
+	port := int32(redisPort)
+	var annotations map[string]string
+	var sourceRanges []string
+	if spec := redis.Spec.Service; spec != nil {
+		if spec.Type != "" {
+			serviceType = spec.Type
+		}
+		if spec.Port != 0 {
+			port = spec.Port
+		}
+		annotations = spec.Annotations
+		// Source ranges are only honored by load balancers
+		if serviceType == corev1.ServiceTypeLoadBalancer {
+			sourceRanges = spec.LoadBalancerSourceRanges
+		}
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        redis.Name,
+			Namespace:   redis.Namespace,
+			Labels:      labelsForRedis(redis),
+			Annotations: annotations,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     serviceType,
+			Selector:                 selectorForPrimary(redis),
+			Ports:                    servicePortsForRedis(redis, port),
+			LoadBalancerSourceRanges: sourceRanges,
+		},
+	}
+	if err := controllerutil.SetControllerReference(redis, service, r.Scheme); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// reconcileService creates the client Service and keeps its type, port, annotations, source
+// ranges and selector in line with the Redis instance. The selector follows the primary
+// after a failover.
+func (r *RedisReconciler) reconcileService(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	logger := log.FromContext(ctx)
+
+	desired, err := r.serviceForRedis(redis)
+	if err != nil {
+		return err
+	}
+
+	foundService := &corev1.Service{}
+	err = r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, foundService)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new Service", "Service.Namespace", desired.Namespace, "Service.Name", desired.Name)
+		if err := r.Create(ctx, desired); err != nil {
+			logger.Error(err, "Failed to create new Service", "Service.Namespace", desired.Namespace, "Service.Name", desired.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get Service")
+		return err
+	}
+
+	if !updateServiceSpec(foundService, desired) {
+		return nil
+	}
+	if err := r.Update(ctx, foundService); err != nil {
+		logger.Error(err, "Failed to update Service", "Service.Namespace", foundService.Namespace, "Service.Name", foundService.Name)
+		return err
+	}
+	logger.Info("Updated Service", "Service.Namespace", foundService.Namespace, "Service.Name", foundService.Name, "Type", foundService.Spec.Type, "Primary", foundService.Spec.Selector[appsv1.StatefulSetPodNameLabel])
+	return nil
+}
+
+// updateServiceSpec copies the managed fields of the desired Service onto the found one and
+// reports whether anything changed. Annotations set by others, such as cloud controllers,
+// are kept, and node ports already allocated are reused unless the Service becomes a ClusterIP.
+func updateServiceSpec(found, desired *corev1.Service) bool {
+	changed := false
+
+	for key, value := range desired.Annotations {
+		if found.Annotations[key] != value {
+			if found.Annotations == nil {
+				found.Annotations = map[string]string{}
+			}
+			found.Annotations[key] = value
+			changed = true
+		}
+	}
+
+	if found.Spec.Type != desired.Spec.Type {
+		found.Spec.Type = desired.Spec.Type
+		changed = true
+	}
+
+	ports := desired.Spec.Ports
+	if desired.Spec.Type != corev1.ServiceTypeClusterIP && len(found.Spec.Ports) == len(ports) {
+		for i := range ports {
+			ports[i].NodePort = found.Spec.Ports[i].NodePort
+		}
+	}
+	if len(ports) != len(found.Spec.Ports) || !equality.Semantic.DeepDerivative(ports, found.Spec.Ports) || (desired.Spec.Type == corev1.ServiceTypeClusterIP && hasNodePort(found.Spec.Ports)) {
+		found.Spec.Ports = ports
+		changed = true
+	}
+
+	if !equality.Semantic.DeepEqual(found.Spec.LoadBalancerSourceRanges, desired.Spec.LoadBalancerSourceRanges) {
+		found.Spec.LoadBalancerSourceRanges = desired.Spec.LoadBalancerSourceRanges
+		changed = true
+	}
+
+	if !equality.Semantic.DeepEqual(found.Spec.Selector, desired.Spec.Selector) {
+		found.Spec.Selector = desired.Spec.Selector
+		changed = true
+	}
+	return changed
+}
+
+// hasNodePort reports whether any of the ports has a node port allocated
+func hasNodePort(ports []corev1.ServicePort) bool {
+	for _, port := range ports {
+		if port.NodePort != 0 {
+			return true
+		}
+	}
+	return false
+}
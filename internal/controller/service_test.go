@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestServiceForRedisDefaults tests that the client Service defaults to a ClusterIP on the Redis port
+func TestServiceForRedisDefaults(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+	}
+	r := newTestReconciler(t)
+
+	// Act
+	service, err := r.serviceForRedis(redis)
+
+	// Assert
+	assert.NoError(t, err, "serviceForRedis should not return an error")
+	assert.Equal(t, "test-redis", service.Name, "Service name should match the Redis name")
+	assert.Equal(t, corev1.ServiceTypeClusterIP, service.Spec.Type, "Service should default to ClusterIP")
+	assert.Equal(t, int32(6379), service.Spec.Ports[0].Port, "Service should default to the Redis port")
+	assert.Equal(t, "test-redis-0", service.Spec.Selector["statefulset.kubernetes.io/pod-name"], "Service should route to the primary")
+	assert.Len(t, service.OwnerReferences, 1, "Service should be owned by the Redis instance")
+}
+
+// TestServiceForRedisLoadBalancer tests that the client Service follows spec.service
+func TestServiceForRedisLoadBalancer(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			Service: &cachev1alpha1.RedisService{
+				Type:                     corev1.ServiceTypeLoadBalancer,
+				Port:                     6380,
+				Annotations:              map[string]string{"service.beta.kubernetes.io/aws-load-balancer-internal": "true"},
+				LoadBalancerSourceRanges: []string{"10.0.0.0/8"},
+			},
+		},
+	}
+	r := newTestReconciler(t)
+
+	// Act
+	service, err := r.serviceForRedis(redis)
+
+	// Assert
+	assert.NoError(t, err, "serviceForRedis should not return an error")
+	assert.Equal(t, corev1.ServiceTypeLoadBalancer, service.Spec.Type, "Service type should match the spec")
+	assert.Equal(t, int32(6380), service.Spec.Ports[0].Port, "Service port should match the spec")
+	assert.Equal(t, "redis", service.Spec.Ports[0].TargetPort.String(), "Service should target the Redis container port")
+	assert.Equal(t, "true", service.Annotations["service.beta.kubernetes.io/aws-load-balancer-internal"], "Annotations should be set")
+	assert.Equal(t, []string{"10.0.0.0/8"}, service.Spec.LoadBalancerSourceRanges, "Source ranges should be set")
+}
+
+// TestUpdateServiceSpec tests that drift is corrected while foreign annotations and node ports are kept
+func TestUpdateServiceSpec(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			Service: &cachev1alpha1.RedisService{
+				Type:        corev1.ServiceTypeNodePort,
+				Annotations: map[string]string{"team": "cache"},
+			},
+		},
+	}
+	r := newTestReconciler(t)
+	desired, err := r.serviceForRedis(redis)
+	assert.NoError(t, err, "serviceForRedis should not return an error")
+	found := desired.DeepCopy()
+	found.Annotations = map[string]string{"cloud": "managed"}
+	found.Spec.Ports[0].NodePort = 30000
+
+	// Act
+	changed := updateServiceSpec(found, desired)
+
+	// Assert
+	assert.True(t, changed, "Missing annotation should be reported as drift")
+	assert.Equal(t, map[string]string{"cloud": "managed", "team": "cache"}, found.Annotations, "Foreign annotations should be kept")
+	assert.Equal(t, int32(30000), found.Spec.Ports[0].NodePort, "Allocated node port should be kept")
+	assert.False(t, updateServiceSpec(found, desired), "Service in sync should not be updated")
+
+	// Switching back to ClusterIP releases the node port
+	redis.Spec.Service.Type = corev1.ServiceTypeClusterIP
+	desired, _ = r.serviceForRedis(redis)
+	assert.True(t, updateServiceSpec(found, desired), "Type change should be reported as drift")
+	assert.Equal(t, int32(0), found.Spec.Ports[0].NodePort, "ClusterIP Service should not keep a node port")
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// volumeSnapshotGroup is the API group of CSI VolumeSnapshots
+	volumeSnapshotGroup = "snapshot.storage.k8s.io"
+	// volumeSnapshotKind is the kind of CSI VolumeSnapshots
+	volumeSnapshotKind = "VolumeSnapshot"
+	// volumeSnapshotLocationScheme prefixes the location of a VolumeSnapshot backup
+	volumeSnapshotLocationScheme = "volumesnapshot://"
+)
+
+// volumeSnapshotGVK is the version of VolumeSnapshots the operator reads and creates. They are
+// handled as unstructured objects, so that the operator runs on clusters without the CRD.
+var volumeSnapshotGVK = schema.GroupVersionKind{Group: volumeSnapshotGroup, Version: "v1", Kind: volumeSnapshotKind}
+
+// newVolumeSnapshot returns an empty VolumeSnapshot to read into
+func newVolumeSnapshot() *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	return snapshot
+}
+
+// backupSnapshotName returns the name of the VolumeSnapshot the backup takes of a data volume claim
+func backupSnapshotName(backup *cachev1alpha1.RedisBackup, claimName string) string {
+	return backup.Name + "-" + claimName
+}
+
+// backupPrimarySnapshotName returns the name of the VolumeSnapshot of the data volume of the
+// primary that was asked to save its data, which holds the backed up RDB file
+func backupPrimarySnapshotName(backup *cachev1alpha1.RedisBackup) string {
+	return backupSnapshotName(backup, dataVolumeName+"-"+backup.Annotations[backupPodAnnotation])
+}
+
+// volumeSnapshotForBackup returns the VolumeSnapshot the backup takes of a data volume claim.
+// It is owned by the backup, so that deleting the backup deletes its snapshots.
+func (r *RedisBackupReconciler) volumeSnapshotForBackup(backup *cachev1alpha1.RedisBackup, claimName string) (*unstructured.Unstructured, error) {
+	snapshot := newVolumeSnapshot()
+	snapshot.SetName(backupSnapshotName(backup, claimName))
+	snapshot.SetNamespace(backup.Namespace)
+	snapshot.SetLabels(map[string]string{backupLabel: backup.Name})
+
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{"persistentVolumeClaimName": claimName},
+	}
+	if className := backup.Spec.Target.VolumeSnapshot.VolumeSnapshotClassName; className != "" {
+		spec["volumeSnapshotClassName"] = className
+	}
+	if err := unstructured.SetNestedMap(snapshot.Object, spec, "spec"); err != nil {
+		return nil, err
+	}
+	if err := controllerutil.SetControllerReference(backup, snapshot, r.Scheme); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// volumeSnapshotState returns whether the VolumeSnapshot is ready to use, its restore size
+// when known, and the error reported by the snapshot controller
+func volumeSnapshotState(snapshot *unstructured.Unstructured) (bool, *resource.Quantity, string) {
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	message, _, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message")
+
+	var restoreSize *resource.Quantity
+	if size, found, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize"); found {
+		if parsed, err := resource.ParseQuantity(size); err == nil {
+			restoreSize = &parsed
+		}
+	}
+	return ready, restoreSize, strings.TrimSpace(message)
+}
+
+// volumeSnapshotLocation returns the location of a VolumeSnapshot backup
+func volumeSnapshotLocation(name string) string {
+	return fmt.Sprintf("%s%s", volumeSnapshotLocationScheme, name)
+}
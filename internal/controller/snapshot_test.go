@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newSnapshotBackup returns a running VolumeSnapshot backup of the given primary pod
+func newSnapshotBackup(primary string) *cachev1alpha1.RedisBackup {
+	now := metav1.Now()
+	return &cachev1alpha1.RedisBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "nightly",
+			Namespace:   "default",
+			Annotations: map[string]string{backupPodAnnotation: primary},
+		},
+		Spec: cachev1alpha1.RedisBackupSpec{
+			RedisName: "test-redis",
+			Target: cachev1alpha1.RedisBackupTarget{
+				VolumeSnapshot: &cachev1alpha1.RedisBackupVolumeSnapshotTarget{VolumeSnapshotClassName: "csi-snapclass"},
+			},
+		},
+		Status: cachev1alpha1.RedisBackupStatus{Phase: cachev1alpha1.RedisBackupRunning, StartTime: &now},
+	}
+}
+
+// newReadyVolumeSnapshot returns a VolumeSnapshot with the given readiness and restore size
+func newReadyVolumeSnapshot(t *testing.T, name string, ready bool, restoreSize string) *unstructured.Unstructured {
+	snapshot := newVolumeSnapshot()
+	snapshot.SetName(name)
+	snapshot.SetNamespace("default")
+	assert.NoError(t, unstructured.SetNestedField(snapshot.Object, ready, "status", "readyToUse"))
+	assert.NoError(t, unstructured.SetNestedField(snapshot.Object, restoreSize, "status", "restoreSize"))
+	return snapshot
+}
+
+// TestVolumeSnapshotForBackup tests the VolumeSnapshot a backup takes of a data volume claim
+func TestVolumeSnapshotForBackup(t *testing.T) {
+	// Arrange
+	backup := newSnapshotBackup("test-redis-0")
+	r := newBackupReconciler(t)
+
+	// Act
+	snapshot, err := r.volumeSnapshotForBackup(backup, "data-test-redis-1")
+
+	// Assert
+	assert.NoError(t, err, "volumeSnapshotForBackup should not return an error")
+	assert.Equal(t, "nightly-data-test-redis-1", snapshot.GetName(), "Snapshot should be named after the backup and claim")
+	assert.True(t, metav1.IsControlledBy(snapshot, backup), "Snapshot should be owned by the backup")
+	claimName, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	assert.Equal(t, "data-test-redis-1", claimName, "Snapshot should be taken of the claim")
+	className, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+	assert.Equal(t, "csi-snapclass", className, "Snapshot class of the target should be used")
+	assert.Equal(t, "volumesnapshot://nightly-data-test-redis-0", backupLocation(backup), "Location should name the snapshot of the primary")
+}
+
+// TestCompleteSnapshotBackup tests that a VolumeSnapshot backup completes once all snapshots are ready
+func TestCompleteSnapshotBackup(t *testing.T) {
+	// Arrange
+	backup := newSnapshotBackup("test-redis-0")
+	backup.Status.VolumeSnapshots = []string{"nightly-data-test-redis-0", "nightly-data-test-redis-1"}
+	r := newBackupReconciler(t, backup)
+	ctx := context.Background()
+	assert.NoError(t, r.Create(ctx, newReadyVolumeSnapshot(t, "nightly-data-test-redis-0", true, "2Gi")))
+	pending := newReadyVolumeSnapshot(t, "nightly-data-test-redis-1", false, "2Gi")
+	assert.NoError(t, r.Create(ctx, pending))
+
+	// Act
+	result, err := r.completeSnapshotBackup(ctx, backup)
+
+	// Assert
+	assert.NoError(t, err, "completeSnapshotBackup should not return an error")
+	assert.Equal(t, backupPollInterval, result.RequeueAfter, "Pending snapshot should be polled")
+	assert.Equal(t, cachev1alpha1.RedisBackupRunning, backup.Status.Phase, "Backup should wait for every snapshot")
+
+	// Arrange
+	assert.NoError(t, unstructured.SetNestedField(pending.Object, true, "status", "readyToUse"))
+	assert.NoError(t, r.Update(ctx, pending))
+
+	// Act
+	_, err = r.completeSnapshotBackup(ctx, backup)
+
+	// Assert
+	assert.NoError(t, err, "completeSnapshotBackup should not return an error")
+	found := &cachev1alpha1.RedisBackup{}
+	assert.NoError(t, r.Get(ctx, types.NamespacedName{Name: "nightly", Namespace: "default"}, found))
+	assert.Equal(t, cachev1alpha1.RedisBackupCompleted, found.Status.Phase, "Backup should be completed")
+	assert.Equal(t, int64(2*1024*1024*1024), found.Status.Size, "Size should be the restore size of the primary snapshot")
+	assert.Equal(t, "volumesnapshot://nightly-data-test-redis-0", found.Status.Location, "Location should name the snapshot of the primary")
+}
+
+// TestCompleteSnapshotBackupFailed tests that a VolumeSnapshot error fails the backup
+func TestCompleteSnapshotBackupFailed(t *testing.T) {
+	// Arrange
+	backup := newSnapshotBackup("test-redis-0")
+	backup.Status.VolumeSnapshots = []string{"nightly-data-test-redis-0"}
+	r := newBackupReconciler(t, backup)
+	snapshot := newReadyVolumeSnapshot(t, "nightly-data-test-redis-0", false, "2Gi")
+	assert.NoError(t, unstructured.SetNestedField(snapshot.Object, "driver does not support snapshots", "status", "error", "message"))
+	assert.NoError(t, r.Create(context.Background(), snapshot))
+
+	// Act
+	_, err := r.completeSnapshotBackup(context.Background(), backup)
+
+	// Assert
+	assert.NoError(t, err, "completeSnapshotBackup should not return an error")
+	assert.Equal(t, cachev1alpha1.RedisBackupFailed, backup.Status.Phase, "Backup should fail")
+	assert.Contains(t, backup.Status.Message, "driver does not support snapshots", "Snapshot error should be reported")
+}
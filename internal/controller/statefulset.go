@@ -0,0 +1,406 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// redisPort is the port Redis listens on inside the pod
+	redisPort = 6379
+	// dataVolumeName is the name of the volume claim template holding the Redis data
+	dataVolumeName = "data"
+	// redisDataDir is the directory Redis persists its data to
+	redisDataDir = "/data"
+)
+
+// statefulSetForRedis returns a Redis StatefulSet object
+func (r *RedisReconciler) statefulSetForRedis(redis *cachev1alpha1.Redis, secretName string) (*appsv1.StatefulSet, error) {
+	labels := labelsForRedis(redis)
+	replicas := desiredReplicas(redis)
+
+	volumeClaims := []corev1.PersistentVolumeClaim{}
+	if persistenceEnabled(redis) {
+		volumeClaim, err := volumeClaimForRedis(redis)
+		if err != nil {
+			return nil, err
+		}
+		volumeClaims = append(volumeClaims, volumeClaim)
+	}
+	resources, err := resourcesForRedis(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redis.Name,
+			Namespace: redis.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: headlessServiceName(redis),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: podAnnotationsForRedis(redis),
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Image:        redis.Spec.Image + ":" + redis.Spec.Version,
+						Name:         redis.Name,
+						Command:      commandForRedis(redis),
+						Ports:        portsForRedis(redis),
+						Env:          envForRedis(redis, secretName),
+						VolumeMounts: volumeMountsForRedis(redis),
+						Resources:    resources,
+					}},
+					Volumes: volumesForRedis(redis),
+				},
+			},
+			VolumeClaimTemplates: volumeClaims,
+		},
+	}
+	if err := controllerutil.SetControllerReference(redis, statefulSet, r.Scheme); err != nil {
+		return nil, err
+	}
+	return statefulSet, nil
+}
+
+// envForRedis returns the environment of the Redis container, which reads the password from the Secret
+func envForRedis(redis *cachev1alpha1.Redis, secretName string) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name: "REDIS_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: secretName,
+					},
+					Key: secretKeyForRedis(redis),
+				},
+			},
+		},
+	}
+}
+
+// volumeMountsForRedis returns the volumes mounted into the Redis container
+func volumeMountsForRedis(redis *cachev1alpha1.Redis) []corev1.VolumeMount {
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      dataVolumeName,
+			MountPath: redisDataDir,
+		},
+		{
+			Name:      redisConfigVolumeName,
+			MountPath: redisConfigDir,
+		},
+		{
+			Name:      redisConfigMapVolumeName,
+			MountPath: redisConfigMapDir,
+			ReadOnly:  true,
+		},
+	}
+	if tlsEnabled(redis) {
+		mounts = append(mounts, tlsVolumeMount())
+	}
+	return mounts
+}
+
+// volumesForRedis returns the pod volumes of a Redis pod, besides the data volume claim.
+// Without persistence the data directory is an emptyDir volume instead of a claim.
+func volumesForRedis(redis *cachev1alpha1.Redis) []corev1.Volume {
+	volumes := []corev1.Volume{
+		{
+			Name: redisConfigVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+		{
+			Name: redisConfigMapVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: configMapName(redis)},
+				},
+			},
+		},
+	}
+	if !persistenceEnabled(redis) {
+		volumes = append(volumes, corev1.Volume{
+			Name: dataVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+	if tlsEnabled(redis) {
+		volumes = append(volumes, tlsVolume(redis))
+	}
+	return volumes
+}
+
+// podAnnotationsForRedis returns the annotations of the Redis pod template
+func podAnnotationsForRedis(redis *cachev1alpha1.Redis) map[string]string {
+	annotations := map[string]string{
+		configHashAnnotation: configHash(redis),
+	}
+	for key, value := range tlsPodAnnotations(redis) {
+		annotations[key] = value
+	}
+	return annotations
+}
+
+// commandForRedis returns the command starting Redis in the topology of the given instance
+func commandForRedis(redis *cachev1alpha1.Redis) []string {
+	if isClusterMode(redis) {
+		return []string{"sh", "-c", clusterStartupScript(redis)}
+	}
+	return []string{"sh", "-c", redisStartupScript(redis)}
+}
+
+// portsForRedis returns the container ports of the Redis container. The plaintext port is
+// left out once it is disabled in favor of TLS.
+func portsForRedis(redis *cachev1alpha1.Redis) []corev1.ContainerPort {
+	ports := []corev1.ContainerPort{}
+	if redisListenPort(redis) != 0 {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          "redis",
+			ContainerPort: redisPort,
+		})
+	}
+	if tlsEnabled(redis) {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          "redis-tls",
+			ContainerPort: redisTLSPort,
+		})
+	}
+	if isClusterMode(redis) {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          "cluster-bus",
+			ContainerPort: int32(clusterBusPortForRedis(redis)),
+		})
+	}
+	return ports
+}
+
+// volumeClaimForRedis returns the volume claim template used for the data directory of each Redis pod
+func volumeClaimForRedis(redis *cachev1alpha1.Redis) (corev1.PersistentVolumeClaim, error) {
+	size, err := resource.ParseQuantity(redis.Spec.Storage.Size)
+	if err != nil {
+		return corev1.PersistentVolumeClaim{}, err
+	}
+
+	claim := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   dataVolumeName,
+			Labels: labelsForRedis(redis),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	// Leave the class unset so the cluster default StorageClass is used
+	if redis.Spec.Storage.StorageClassName != "" {
+		storageClassName := redis.Spec.Storage.StorageClassName
+		claim.Spec.StorageClassName = &storageClassName
+	}
+	return claim, nil
+}
+
+// resourcesForRedis returns the compute resources of the Redis container. Empty quantities are
+// left unset, so that an empty limit leaves the resource unlimited.
+func resourcesForRedis(redis *cachev1alpha1.Redis) (corev1.ResourceRequirements, error) {
+	requests, err := resourceListForRedis(redis.Spec.Resources.Requests.CPU, redis.Spec.Resources.Requests.Memory)
+	if err != nil {
+		return corev1.ResourceRequirements{}, fmt.Errorf("invalid resource requests: %w", err)
+	}
+	limits, err := resourceListForRedis(redis.Spec.Resources.Limits.CPU, redis.Spec.Resources.Limits.Memory)
+	if err != nil {
+		return corev1.ResourceRequirements{}, fmt.Errorf("invalid resource limits: %w", err)
+	}
+	return corev1.ResourceRequirements{Requests: requests, Limits: limits}, nil
+}
+
+// resourceListForRedis parses the CPU and memory quantities, leaving out empty ones
+func resourceListForRedis(cpu, memory string) (corev1.ResourceList, error) {
+	list := corev1.ResourceList{}
+	for name, value := range map[corev1.ResourceName]string{corev1.ResourceCPU: cpu, corev1.ResourceMemory: memory} {
+		if value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", name, value, err)
+		}
+		list[name] = quantity
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list, nil
+}
+
+// updateStatefulSetAndStatus updates the StatefulSet and status of a Redis resource.
+// It compares the Redis resource with the existing StatefulSet and makes necessary updates
+// to the StatefulSet size, image, configuration, password Secret and resources, which are
+// written in a single update so that the pods roll once. The volume claim templates of a StatefulSet
+// are immutable, so storage size changes are applied to the volume claims by reconcileStorage instead. Enabling or
+// disabling persistence recreates the StatefulSet.
+func (r *RedisReconciler) updateStatefulSetAndStatus(ctx context.Context, redis *cachev1alpha1.Redis, foundStatefulSet *appsv1.StatefulSet, secretName string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// Recreate the StatefulSet when persistence is enabled or disabled, since only a new
+	// StatefulSet can add or drop the data volume claim. The pods are orphaned rather than
+	// deleted and are adopted and rolled by the new StatefulSet.
+	if persistenceEnabled(redis) != (len(foundStatefulSet.Spec.VolumeClaimTemplates) > 0) {
+		err := r.Delete(ctx, foundStatefulSet, client.PropagationPolicy(metav1.DeletePropagationOrphan))
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete StatefulSet", "StatefulSet.Namespace", foundStatefulSet.Namespace, "StatefulSet.Name", foundStatefulSet.Name)
+			return ctrl.Result{}, err
+		}
+		logger.Info("Deleted StatefulSet to change persistence", "StatefulSet.Namespace", foundStatefulSet.Namespace, "StatefulSet.Name", foundStatefulSet.Name, "Persistence", persistenceMode(redis))
+		meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+			Type:               typeAvailableRedis,
+			Status:             metav1.ConditionFalse,
+			Reason:             "RecreatingStatefulSet",
+			Message:            fmt.Sprintf("StatefulSet %s was deleted, keeping its pods, to change persistence to %s, and is being recreated", foundStatefulSet.Name, persistenceMode(redis)),
+			ObservedGeneration: redis.Generation,
+		})
+		if err := r.Status().Update(ctx, redis); err != nil {
+			logger.Error(err, "Failed to update Redis status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// Collect the changes, so that they are written in a single update
+	changes := []string{}
+
+	// Update the StatefulSet size if necessary
+	size := desiredReplicas(redis)
+	if *foundStatefulSet.Spec.Replicas != size {
+		foundStatefulSet.Spec.Replicas = &size
+		changes = append(changes, "size")
+	}
+
+	// Check for updates in the image or version
+	container := &foundStatefulSet.Spec.Template.Spec.Containers[0]
+	if container.Image != (redis.Spec.Image + ":" + redis.Spec.Version) {
+		container.Image = (redis.Spec.Image + ":" + redis.Spec.Version)
+		changes = append(changes, "image")
+	}
+
+	// Check for updates in the startup command, ports and volumes, which change with the topology
+	// and TLS. Lengths are compared too, since volumes and ports are dropped when TLS is disabled.
+	command := commandForRedis(redis)
+	ports := portsForRedis(redis)
+	volumeMounts := volumeMountsForRedis(redis)
+	volumes := volumesForRedis(redis)
+	podSpec := &foundStatefulSet.Spec.Template.Spec
+	if !equality.Semantic.DeepEqual(container.Command, command) || !equality.Semantic.DeepDerivative(ports, container.Ports) ||
+		!equality.Semantic.DeepDerivative(volumeMounts, container.VolumeMounts) || !equality.Semantic.DeepDerivative(volumes, podSpec.Volumes) ||
+		len(ports) != len(container.Ports) || len(volumeMounts) != len(container.VolumeMounts) || len(volumes) != len(podSpec.Volumes) {
+		container.Command = command
+		container.Ports = ports
+		container.VolumeMounts = volumeMounts
+		podSpec.Volumes = volumes
+		changes = append(changes, "command")
+	}
+
+	// Roll the pods when the annotations change, such as the hash of the configuration
+	template := &foundStatefulSet.Spec.Template
+	annotations := podAnnotationsForRedis(redis)
+	if !equality.Semantic.DeepDerivative(annotations, template.Annotations) {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			template.Annotations[key] = value
+		}
+		changes = append(changes, "pod annotations")
+	}
+
+	// Check for updates in the Secret the password is read from
+	env := envForRedis(redis, secretName)
+	if !equality.Semantic.DeepDerivative(env, container.Env) {
+		container.Env = env
+		changes = append(changes, "environment")
+	}
+
+	// Check for updates in the resources
+	resources, err := resourcesForRedis(redis)
+	if err != nil {
+		logger.Error(err, "Failed to define StatefulSet resources", "StatefulSet.Namespace", foundStatefulSet.Namespace, "StatefulSet.Name", foundStatefulSet.Name)
+		return ctrl.Result{}, err
+	}
+	if !equality.Semantic.DeepEqual(container.Resources, resources) {
+		container.Resources = resources
+		changes = append(changes, "resources")
+	}
+
+	if len(changes) > 0 {
+		if err := r.Update(ctx, foundStatefulSet); err != nil {
+			logger.Error(err, "Failed to update StatefulSet", "StatefulSet.Namespace", foundStatefulSet.Namespace, "StatefulSet.Name", foundStatefulSet.Name, "Changes", changes)
+			return ctrl.Result{}, err
+		}
+		logger.Info("Updated StatefulSet", "StatefulSet.Namespace", foundStatefulSet.Namespace, "StatefulSet.Name", foundStatefulSet.Name, "Changes", changes)
+	}
+
+	err = r.updateRedisStatus(ctx, redis, foundStatefulSet)
+	if err != nil {
+		logger.Error(err, "Failed to update Redis status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// deleteLegacyDeployment removes the Deployment created by earlier versions of the
+// operator once the StatefulSet has taken over. Deployments not controlled by the
+// Redis instance are left untouched.
+func (r *RedisReconciler) deleteLegacyDeployment(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	logger := log.FromContext(ctx)
+
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace}, deployment)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !metav1.IsControlledBy(deployment, redis) {
+		return nil
+	}
+
+	logger.Info("Deleting legacy Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+	err = r.Delete(ctx, deployment)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
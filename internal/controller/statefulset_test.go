@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// newTestReconciler returns a RedisReconciler with a scheme that knows the Redis types
+func newTestReconciler(t *testing.T) *RedisReconciler {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, cachev1alpha1.AddToScheme(scheme))
+	return &RedisReconciler{Scheme: scheme}
+}
+
+// newFakeReconciler returns a RedisReconciler backed by a fake client holding the given objects
+func newFakeReconciler(t *testing.T, objs ...client.Object) *RedisReconciler {
+	r := newTestReconciler(t)
+	r.Client = fake.NewClientBuilder().WithScheme(r.Scheme).WithObjects(objs...).Build()
+	return r
+}
+
+// newTestRedis returns a standalone Redis instance with the required fields set, which tests
+// extend with the features they exercise
+func newTestRedis() *cachev1alpha1.Redis {
+	return &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"},
+		Spec: cachev1alpha1.RedisSpec{
+			Replicas: 3,
+			Image:    "redis",
+			Version:  "7.2",
+			Storage:  cachev1alpha1.RedisStorage{Size: "1Gi"},
+			Resources: cachev1alpha1.RedisResources{
+				Requests: cachev1alpha1.Requests{CPU: "100m", Memory: "128Mi"},
+				Limits:   cachev1alpha1.Limits{CPU: "500m", Memory: "256Mi"},
+			},
+		},
+	}
+}
+
+// TestStatefulSetForRedis tests the statefulSetForRedis function
+func TestStatefulSetForRedis(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-redis",
+			Namespace: "default",
+		},
+		Spec: cachev1alpha1.RedisSpec{
+			Replicas: 3,
+			Image:    "redis",
+			Version:  "6.2",
+			Storage: cachev1alpha1.RedisStorage{
+				Size:             "2Gi",
+				StorageClassName: "fast",
+			},
+			Resources: cachev1alpha1.RedisResources{
+				Requests: cachev1alpha1.Requests{
+					CPU:    "500m",
+					Memory: "512Mi",
+				},
+				Limits: cachev1alpha1.Limits{
+					CPU:    "1",
+					Memory: "1Gi",
+				},
+			},
+		},
+	}
+
+	secretName := "redis-secret"
+	r := newTestReconciler(t)
+
+	// Act
+	statefulSet, err := r.statefulSetForRedis(redis, secretName)
+
+	// Assert
+	assert.NoError(t, err, "statefulSetForRedis should not return an error")
+	assert.Equal(t, redis.Name, statefulSet.Name, "StatefulSet name should match Redis name")
+	assert.Equal(t, redis.Namespace, statefulSet.Namespace, "StatefulSet namespace should match Redis namespace")
+	assert.Equal(t, redis.Spec.Replicas, *statefulSet.Spec.Replicas, "StatefulSet replicas should match Redis replicas")
+	assert.Equal(t, "test-redis-headless", statefulSet.Spec.ServiceName, "StatefulSet should be governed by the headless Service")
+	assert.Equal(t, redis.Spec.Image+":6.2", statefulSet.Spec.Template.Spec.Containers[0].Image, "StatefulSet image should match Redis image and version")
+	assert.Equal(t, secretName, statefulSet.Spec.Template.Spec.Containers[0].Env[0].ValueFrom.SecretKeyRef.Name, "Secret name should match")
+	assert.Equal(t, "password", statefulSet.Spec.Template.Spec.Containers[0].Env[0].ValueFrom.SecretKeyRef.Key, "Secret key should match")
+
+	requests := statefulSet.Spec.Template.Spec.Containers[0].Resources.Requests
+	limits := statefulSet.Spec.Template.Spec.Containers[0].Resources.Limits
+	assert.Equal(t, "500m", requests.Cpu().String(), "CPU request should match")
+	assert.Equal(t, "512Mi", requests.Memory().String(), "Memory request should match")
+	assert.Equal(t, "1", limits.Cpu().String(), "CPU limit should match")
+	assert.Equal(t, "1Gi", limits.Memory().String(), "Memory limit should match")
+
+	assert.Len(t, statefulSet.Spec.VolumeClaimTemplates, 1, "StatefulSet should have one volume claim template")
+	claim := statefulSet.Spec.VolumeClaimTemplates[0]
+	storage := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	assert.Equal(t, "2Gi", storage.String(), "Volume claim size should match storage size")
+	assert.Equal(t, "fast", *claim.Spec.StorageClassName, "Volume claim storage class should match")
+	assert.Equal(t, claim.Name, statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts[0].Name, "Data volume should be mounted")
+	assert.Equal(t, "/data", statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath, "Data volume should be mounted at the Redis data dir")
+}
+
+// TestVolumeClaimForRedisDefaultStorageClass tests that an empty StorageClassName uses the cluster default
+func TestVolumeClaimForRedisDefaultStorageClass(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		Spec: cachev1alpha1.RedisSpec{
+			Storage: cachev1alpha1.RedisStorage{Size: "1Gi"},
+		},
+	}
+
+	claim, err := volumeClaimForRedis(redis)
+
+	assert.NoError(t, err, "volumeClaimForRedis should not return an error")
+	assert.Nil(t, claim.Spec.StorageClassName, "Storage class should be left unset")
+}
+
+// TestVolumeClaimForRedisInvalidSize tests that an invalid storage size is reported
+func TestVolumeClaimForRedisInvalidSize(t *testing.T) {
+	redis := &cachev1alpha1.Redis{
+		Spec: cachev1alpha1.RedisSpec{
+			Storage: cachev1alpha1.RedisStorage{Size: "1GB"},
+		},
+	}
+
+	_, err := volumeClaimForRedis(redis)
+
+	assert.Error(t, err, "volumeClaimForRedis should reject an invalid size")
+}
+
+// TestResourcesForRedis tests that invalid quantities are reported instead of panicking and empty limits are left unset
+func TestResourcesForRedis(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		Spec: cachev1alpha1.RedisSpec{
+			Resources: cachev1alpha1.RedisResources{
+				Requests: cachev1alpha1.Requests{CPU: "100m", Memory: "128Mi"},
+			},
+		},
+	}
+
+	// Act
+	resources, err := resourcesForRedis(redis)
+	redis.Spec.Resources.Limits.Memory = "512MB"
+	_, invalidErr := resourcesForRedis(redis)
+
+	// Assert
+	assert.NoError(t, err, "resourcesForRedis should not return an error")
+	assert.Equal(t, "128Mi", resources.Requests.Memory().String(), "Memory request should match")
+	assert.Empty(t, resources.Limits, "Empty limits should be left unset")
+	assert.ErrorContains(t, invalidErr, "512MB", "Invalid quantity should be reported")
+}
+
+// newStatefulSetReconciler returns a RedisReconciler backed by a fake client holding the Redis
+// instance and its StatefulSet, which counts the updates of the StatefulSet
+func newStatefulSetReconciler(t *testing.T, redis *cachev1alpha1.Redis, statefulSet *appsv1.StatefulSet, updates *int) *RedisReconciler {
+	r := newTestReconciler(t)
+	r.Client = fake.NewClientBuilder().WithScheme(r.Scheme).WithObjects(redis, statefulSet).WithStatusSubresource(redis).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				if _, ok := obj.(*appsv1.StatefulSet); ok {
+					*updates++
+				}
+				return c.Update(ctx, obj, opts...)
+			},
+		}).Build()
+	return r
+}
+
+// TestUpdateStatefulSetAndStatus tests that all changes are written in a single StatefulSet update
+func TestUpdateStatefulSetAndStatus(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	r := newTestReconciler(t)
+	statefulSet, err := r.statefulSetForRedis(redis, "redis-secret")
+	assert.NoError(t, err)
+	redis.Spec.Replicas = 5
+	redis.Spec.Version = "7.4"
+	redis.Spec.Resources.Limits.Memory = "512Mi"
+	var updates int
+	r = newStatefulSetReconciler(t, redis, statefulSet, &updates)
+
+	// Act
+	found := &appsv1.StatefulSet{}
+	assert.NoError(t, r.Get(context.TODO(), types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace}, found))
+	_, err = r.updateStatefulSetAndStatus(context.TODO(), redis, found, "redis-secret")
+
+	// Assert
+	assert.NoError(t, err, "updateStatefulSetAndStatus should not return an error")
+	assert.Equal(t, 1, updates, "StatefulSet should be updated once")
+	updated := &appsv1.StatefulSet{}
+	assert.NoError(t, r.Get(context.TODO(), types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace}, updated))
+	assert.Equal(t, int32(5), *updated.Spec.Replicas, "Size should be updated")
+	assert.Equal(t, "redis:7.4", updated.Spec.Template.Spec.Containers[0].Image, "Image should be updated")
+	assert.Equal(t, "512Mi", updated.Spec.Template.Spec.Containers[0].Resources.Limits.Memory().String(), "Resources should be updated")
+}
+
+// TestUpdateStatefulSetAndStatusPersistenceChanged tests that recreating the StatefulSet to change
+// persistence is reported in the status
+func TestUpdateStatefulSetAndStatusPersistenceChanged(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	r := newTestReconciler(t)
+	statefulSet, err := r.statefulSetForRedis(redis, "redis-secret")
+	assert.NoError(t, err)
+	redis.Spec.Persistence = &cachev1alpha1.RedisPersistence{Mode: cachev1alpha1.RedisPersistenceNone}
+	var updates int
+	r = newStatefulSetReconciler(t, redis, statefulSet, &updates)
+
+	// Act
+	result, err := r.updateStatefulSetAndStatus(context.TODO(), redis, statefulSet, "redis-secret")
+
+	// Assert
+	assert.NoError(t, err, "updateStatefulSetAndStatus should not return an error")
+	assert.True(t, result.Requeue, "Reconcile should be requeued to recreate the StatefulSet")
+	assert.Zero(t, updates, "StatefulSet should not be updated")
+	err = r.Get(context.TODO(), types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace}, &appsv1.StatefulSet{})
+	assert.True(t, errors.IsNotFound(err), "StatefulSet should be deleted")
+
+	updated := &cachev1alpha1.Redis{}
+	assert.NoError(t, r.Get(context.TODO(), types.NamespacedName{Name: redis.Name, Namespace: redis.Namespace}, updated))
+	condition := meta.FindStatusCondition(updated.Status.Conditions, typeAvailableRedis)
+	if assert.NotNil(t, condition, "Available condition should be set") {
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Equal(t, "RecreatingStatefulSet", condition.Reason)
+		assert.Contains(t, condition.Message, persistenceMode(redis), "Message should name the persistence mode")
+	}
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// retainedAtAnnotation records on a data volume claim when it was retained after its Redis
+// instance was deleted, until a new instance of the same name adopts it
+const retainedAtAnnotation = "cache.tc/retained-at"
+
+// listDataVolumeClaims returns the data volume claims of the Redis pods, sorted by name
+func listDataVolumeClaims(ctx context.Context, c client.Reader, redis *cachev1alpha1.Redis) ([]corev1.PersistentVolumeClaim, error) {
+	claimList := &corev1.PersistentVolumeClaimList{}
+	if err := c.List(ctx, claimList, client.InNamespace(redis.Namespace), client.MatchingLabels(labelsForRedis(redis))); err != nil {
+		return nil, err
+	}
+
+	prefix := dataVolumeName + "-" + redis.Name + "-"
+	claims := []corev1.PersistentVolumeClaim{}
+	for _, claim := range claimList.Items {
+		if strings.HasPrefix(claim.Name, prefix) {
+			claims = append(claims, claim)
+		}
+	}
+	sort.Slice(claims, func(i, j int) bool { return claims[i].Name < claims[j].Name })
+	return claims, nil
+}
+
+// volumeExpansionAllowed reports whether the StorageClass of the claim allows volume expansion
+func (r *RedisReconciler) volumeExpansionAllowed(ctx context.Context, claim *corev1.PersistentVolumeClaim) (bool, error) {
+	if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName == "" {
+		return false, nil
+	}
+	storageClass := &storagev1.StorageClass{}
+	err := r.Get(ctx, types.NamespacedName{Name: *claim.Spec.StorageClassName}, storageClass)
+	if err != nil && errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return storageClass.AllowVolumeExpansion != nil && *storageClass.AllowVolumeExpansion, nil
+}
+
+// reconcileStorage expands the data volume claims to spec.storage.size and reports whether
+// volumes are still being resized. Claims are expanded once their StorageClass allows it and
+// are resized until the file system reports the new capacity. Shrinking is rejected in the
+// StorageResized condition, since volumes cannot shrink. The volume claim template of the
+// StatefulSet is immutable, so volumes of pods added later are expanded once created.
+func (r *RedisReconciler) reconcileStorage(ctx context.Context, redis *cachev1alpha1.Redis) (bool, error) {
+	logger := log.FromContext(ctx)
+	if !persistenceEnabled(redis) {
+		redis.Status.Storage = nil
+		meta.RemoveStatusCondition(&redis.Status.Conditions, typeStorageResizedRedis)
+		return false, nil
+	}
+
+	size, err := resource.ParseQuantity(redis.Spec.Storage.Size)
+	if err != nil {
+		return false, err
+	}
+	claims, err := listDataVolumeClaims(ctx, r.Client, redis)
+	if err != nil {
+		return false, err
+	}
+
+	condition := metav1.Condition{
+		Type:               typeStorageResizedRedis,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Resized",
+		Message:            fmt.Sprintf("All %d data volumes have %s", len(claims), size.String()),
+		ObservedGeneration: redis.Generation,
+	}
+	status := &cachev1alpha1.RedisStorageStatus{}
+	var capacity *resource.Quantity
+	shrunk := []string{}
+	notExpandable := []string{}
+
+	for i := range claims {
+		claim := &claims[i]
+		if current, found := claim.Status.Capacity[corev1.ResourceStorage]; found && (capacity == nil || current.Cmp(*capacity) < 0) {
+			capacity = &current
+		}
+
+		requested := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		switch requested.Cmp(size) {
+		case 1:
+			shrunk = append(shrunk, fmt.Sprintf("%s has %s", claim.Name, requested.String()))
+			continue
+		case -1:
+			allowed, err := r.volumeExpansionAllowed(ctx, claim)
+			if err != nil {
+				return false, err
+			}
+			if !allowed {
+				notExpandable = append(notExpandable, claim.Name)
+				continue
+			}
+			claim.Spec.Resources.Requests[corev1.ResourceStorage] = size
+			if err := r.Update(ctx, claim); err != nil {
+				logger.Error(err, "Failed to expand PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name)
+				return false, err
+			}
+			logger.Info("Expanding PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name, "Size", size.String())
+		}
+
+		// A bound claim is resized once the file system reports the requested capacity
+		if current := claim.Status.Capacity[corev1.ResourceStorage]; claim.Status.Phase == corev1.ClaimBound && current.Cmp(size) < 0 {
+			status.ResizingVolumes = append(status.ResizingVolumes, claim.Name)
+		}
+	}
+	if capacity != nil {
+		status.Capacity = capacity.String()
+	}
+	redis.Status.Storage = status
+
+	switch {
+	case len(shrunk) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ShrinkNotSupported"
+		condition.Message = fmt.Sprintf("spec.storage.size %s is smaller than the data volumes, which cannot shrink: %s", size.String(), strings.Join(shrunk, ", "))
+	case len(notExpandable) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ExpansionNotSupported"
+		condition.Message = fmt.Sprintf("The StorageClass of %s does not allow volume expansion", strings.Join(notExpandable, ", "))
+	case len(status.ResizingVolumes) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Resizing"
+		condition.Message = fmt.Sprintf("%d of %d data volumes are being expanded to %s", len(status.ResizingVolumes), len(claims), size.String())
+	}
+	meta.SetStatusCondition(&redis.Status.Conditions, condition)
+	return len(status.ResizingVolumes) > 0, nil
+}
+
+// deleteOrRetainDataVolumeClaims deletes the data volume claims of a deleted Redis instance
+// when spec.storage.retentionPolicy is Delete, and otherwise marks them as retained so that
+// they outlive the instance
+func (r *RedisReconciler) deleteOrRetainDataVolumeClaims(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	logger := log.FromContext(ctx)
+
+	claims, err := listDataVolumeClaims(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+	for i := range claims {
+		claim := &claims[i]
+		if redis.Spec.Storage.RetentionPolicy == cachev1alpha1.RedisStorageRetentionDelete {
+			if err := r.Delete(ctx, claim); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			logger.Info("Deleted PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name)
+			continue
+		}
+
+		if _, found := claim.Annotations[retainedAtAnnotation]; found {
+			continue
+		}
+		if claim.Annotations == nil {
+			claim.Annotations = map[string]string{}
+		}
+		claim.Annotations[retainedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		if err := r.Update(ctx, claim); err != nil {
+			return err
+		}
+		logger.Info("Retained PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name)
+	}
+	return nil
+}
+
+// adoptRetainedDataVolumeClaims adopts the data volume claims retained from a deleted instance
+// of the same name. The StatefulSet mounts them as they match its volume claim template.
+func (r *RedisReconciler) adoptRetainedDataVolumeClaims(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	logger := log.FromContext(ctx)
+
+	claims, err := listDataVolumeClaims(ctx, r.Client, redis)
+	if err != nil {
+		return err
+	}
+	for i := range claims {
+		claim := &claims[i]
+		retainedAt, found := claim.Annotations[retainedAtAnnotation]
+		if !found {
+			continue
+		}
+		delete(claim.Annotations, retainedAtAnnotation)
+		if err := r.Update(ctx, claim); err != nil {
+			return err
+		}
+		logger.Info("Adopted retained PersistentVolumeClaim", "PersistentVolumeClaim.Namespace", claim.Namespace, "PersistentVolumeClaim.Name", claim.Name, "RetainedAt", retainedAt)
+	}
+	return nil
+}
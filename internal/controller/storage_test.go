@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newDataVolumeClaim returns a bound data volume claim of the given size
+func newDataVolumeClaim(name, size, storageClassName string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "test-redis"}},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClassName,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase:    corev1.ClaimBound,
+			Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+		},
+	}
+}
+
+// TestReconcileStorageExpand tests that the data volumes are expanded when spec.storage.size grows
+func TestReconcileStorageExpand(t *testing.T) {
+	// Arrange
+	allowExpansion := true
+	storageClass := &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: "expandable"},
+		Provisioner:          "ebs.csi.aws.com",
+		AllowVolumeExpansion: &allowExpansion,
+	}
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"},
+		Spec:       cachev1alpha1.RedisSpec{Storage: cachev1alpha1.RedisStorage{Size: "2Gi"}},
+	}
+	r := newFakeReconciler(t, redis, storageClass,
+		newDataVolumeClaim("data-test-redis-0", "1Gi", "expandable"),
+		newDataVolumeClaim("data-test-redis-1", "2Gi", "expandable"),
+		newDataVolumeClaim("data-other-redis-0", "1Gi", "expandable"))
+
+	// Act
+	resizing, err := r.reconcileStorage(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "reconcileStorage should not return an error")
+	assert.True(t, resizing, "Expanded volume should be resizing")
+	claim := &corev1.PersistentVolumeClaim{}
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "data-test-redis-0", Namespace: "default"}, claim))
+	assert.Equal(t, "2Gi", claim.Spec.Resources.Requests.Storage().String(), "Smaller claim should be expanded")
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "data-other-redis-0", Namespace: "default"}, claim))
+	assert.Equal(t, "1Gi", claim.Spec.Resources.Requests.Storage().String(), "Claims of other instances should be left untouched")
+	assert.Equal(t, []string{"data-test-redis-0"}, redis.Status.Storage.ResizingVolumes, "Resizing volumes should be reported")
+	assert.Equal(t, "1Gi", redis.Status.Storage.Capacity, "Smallest capacity should be reported")
+	condition := meta.FindStatusCondition(redis.Status.Conditions, typeStorageResizedRedis)
+	assert.Equal(t, "Resizing", condition.Reason, "Resize should be in progress")
+}
+
+// TestReconcileStorageRejected tests that shrinking and unsupported expansions are reported
+func TestReconcileStorageRejected(t *testing.T) {
+	// Arrange
+	storageClass := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "standard"}, Provisioner: "kubernetes.io/no-provisioner"}
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"},
+		Spec:       cachev1alpha1.RedisSpec{Storage: cachev1alpha1.RedisStorage{Size: "2Gi"}},
+	}
+	r := newFakeReconciler(t, redis, storageClass, newDataVolumeClaim("data-test-redis-0", "1Gi", "standard"))
+
+	// Act
+	resizing, err := r.reconcileStorage(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "reconcileStorage should not return an error")
+	assert.False(t, resizing, "Volume should not be resizing")
+	condition := meta.FindStatusCondition(redis.Status.Conditions, typeStorageResizedRedis)
+	assert.Equal(t, "ExpansionNotSupported", condition.Reason, "StorageClass without expansion should be reported")
+
+	// Arrange
+	redis.Spec.Storage.Size = "512Mi"
+
+	// Act
+	_, err = r.reconcileStorage(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "reconcileStorage should not return an error")
+	condition = meta.FindStatusCondition(redis.Status.Conditions, typeStorageResizedRedis)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status, "Shrinking should be rejected")
+	assert.Equal(t, "ShrinkNotSupported", condition.Reason, "Shrinking should be reported")
+	assert.Contains(t, condition.Message, "data-test-redis-0 has 1Gi", "Message should name the larger volume")
+}
+
+// TestDeleteOrRetainDataVolumeClaimsDelete tests that the data volume claims are deleted with the Delete retention policy
+func TestDeleteOrRetainDataVolumeClaimsDelete(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"},
+		Spec: cachev1alpha1.RedisSpec{Storage: cachev1alpha1.RedisStorage{
+			Size:            "1Gi",
+			RetentionPolicy: cachev1alpha1.RedisStorageRetentionDelete,
+		}},
+	}
+	r := newFakeReconciler(t, redis,
+		newDataVolumeClaim("data-test-redis-0", "1Gi", "standard"),
+		newDataVolumeClaim("data-other-redis-0", "1Gi", "standard"))
+
+	// Act
+	err := r.deleteOrRetainDataVolumeClaims(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "deleteOrRetainDataVolumeClaims should not return an error")
+	claim := &corev1.PersistentVolumeClaim{}
+	err = r.Get(context.Background(), types.NamespacedName{Name: "data-test-redis-0", Namespace: "default"}, claim)
+	assert.True(t, errors.IsNotFound(err), "Claim of the instance should be deleted")
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "data-other-redis-0", Namespace: "default"}, claim), "Claims of other instances should be kept")
+}
+
+// TestDeleteOrRetainDataVolumeClaimsRetain tests that the data volume claims are kept and marked with the Retain retention policy
+func TestDeleteOrRetainDataVolumeClaimsRetain(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"},
+		Spec: cachev1alpha1.RedisSpec{Storage: cachev1alpha1.RedisStorage{
+			Size:            "1Gi",
+			RetentionPolicy: cachev1alpha1.RedisStorageRetentionRetain,
+		}},
+	}
+	r := newFakeReconciler(t, redis, newDataVolumeClaim("data-test-redis-0", "1Gi", "standard"))
+
+	// Act
+	err := r.deleteOrRetainDataVolumeClaims(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "deleteOrRetainDataVolumeClaims should not return an error")
+	claim := &corev1.PersistentVolumeClaim{}
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "data-test-redis-0", Namespace: "default"}, claim), "Claim should be kept")
+	assert.Contains(t, claim.Annotations, retainedAtAnnotation, "Claim should be marked as retained")
+}
+
+// TestAdoptRetainedDataVolumeClaims tests that a new instance of the same name adopts the retained data volume claims
+func TestAdoptRetainedDataVolumeClaims(t *testing.T) {
+	// Arrange
+	redis := &cachev1alpha1.Redis{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis", Namespace: "default"},
+		Spec:       cachev1alpha1.RedisSpec{Storage: cachev1alpha1.RedisStorage{Size: "1Gi"}},
+	}
+	retained := newDataVolumeClaim("data-test-redis-0", "1Gi", "standard")
+	retained.Annotations = map[string]string{retainedAtAnnotation: "2024-01-01T00:00:00Z"}
+	r := newFakeReconciler(t, redis, retained)
+
+	// Act
+	err := r.adoptRetainedDataVolumeClaims(context.Background(), redis)
+
+	// Assert
+	assert.NoError(t, err, "adoptRetainedDataVolumeClaims should not return an error")
+	claim := &corev1.PersistentVolumeClaim{}
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "data-test-redis-0", Namespace: "default"}, claim))
+	assert.NotContains(t, claim.Annotations, retainedAtAnnotation, "Adopted claim should no longer be marked as retained")
+}
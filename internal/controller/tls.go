@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// redisTLSPort is the port Redis accepts TLS connections on inside the pod
+	redisTLSPort = 6380
+	// sentinelTLSPort is the port Redis Sentinel accepts TLS connections on inside the pod
+	sentinelTLSPort = 26380
+	// tlsVolumeName is the name of the volume the TLS Secret is mounted from
+	tlsVolumeName = "tls"
+	// redisTLSDir is the directory the TLS Secret is mounted to
+	redisTLSDir = "/etc/redis-tls"
+	// tlsHashAnnotation records the hash of the TLS certificate on the pod templates, so that
+	// the pods restart and serve a renewed certificate
+	tlsHashAnnotation = "cache.tc/tls-hash"
+)
+
+// certificateGVK is the version of cert-manager Certificates the operator creates. They are
+// handled as unstructured objects, so that the operator runs on clusters without cert-manager.
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// tlsEnabled reports whether the Redis and Sentinel servers accept TLS connections
+func tlsEnabled(redis *cachev1alpha1.Redis) bool {
+	return redis.Spec.TLS != nil
+}
+
+// tlsSecretName returns the name of the Secret holding the certificate, which cert-manager
+// issues to "<name>-tls" unless spec.tls.secretName points at an existing Secret
+func tlsSecretName(redis *cachev1alpha1.Redis) string {
+	if redis.Spec.TLS.SecretName != "" {
+		return redis.Spec.TLS.SecretName
+	}
+	return redis.Name + "-tls"
+}
+
+// redisListenPort returns the plaintext port of the Redis servers, 0 when it is closed
+func redisListenPort(redis *cachev1alpha1.Redis) int {
+	if tlsEnabled(redis) && redis.Spec.TLS.DisablePlaintext {
+		return 0
+	}
+	return redisPort
+}
+
+// redisServerPort returns the port replication, the cluster bus, Sentinel and the operator
+// connect to, which is the TLS port once TLS is enabled
+func redisServerPort(redis *cachev1alpha1.Redis) int {
+	if tlsEnabled(redis) {
+		return redisTLSPort
+	}
+	return redisPort
+}
+
+// sentinelServerPort returns the port the Sentinels and the operator connect to a Sentinel on
+func sentinelServerPort(redis *cachev1alpha1.Redis) int {
+	if tlsEnabled(redis) {
+		return sentinelTLSPort
+	}
+	return sentinelPort
+}
+
+// tlsDirectives returns the redis.conf directives serving TLS on redisTLSPort with the mounted
+// certificate. Clients authenticate with the password rather than a client certificate.
+func tlsDirectives(redis *cachev1alpha1.Redis) map[string]string {
+	if !tlsEnabled(redis) {
+		return map[string]string{}
+	}
+	directives := map[string]string{
+		"tls-port":         strconv.Itoa(redisTLSPort),
+		"tls-cert-file":    path.Join(redisTLSDir, corev1.TLSCertKey),
+		"tls-key-file":     path.Join(redisTLSDir, corev1.TLSPrivateKeyKey),
+		"tls-ca-cert-file": path.Join(redisTLSDir, corev1.ServiceAccountRootCAKey),
+		"tls-auth-clients": "no",
+		"tls-replication":  "yes",
+	}
+	if isClusterMode(redis) {
+		directives["tls-cluster"] = "yes"
+	}
+	return directives
+}
+
+// redisCLITLSFlags returns the redis-cli flags connecting over TLS, empty without TLS
+func redisCLITLSFlags(redis *cachev1alpha1.Redis) string {
+	if !tlsEnabled(redis) {
+		return ""
+	}
+	return fmt.Sprintf(" --tls --cacert %s", path.Join(redisTLSDir, corev1.ServiceAccountRootCAKey))
+}
+
+// tlsVolume returns the volume the TLS Secret is mounted from
+func tlsVolume(redis *cachev1alpha1.Redis) corev1.Volume {
+	return corev1.Volume{
+		Name: tlsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: tlsSecretName(redis)},
+		},
+	}
+}
+
+// tlsVolumeMount returns the mount of the TLS Secret
+func tlsVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{Name: tlsVolumeName, MountPath: redisTLSDir, ReadOnly: true}
+}
+
+// tlsDNSNames returns the names the certificate is issued for: the client Service, every
+// Redis and Sentinel pod behind their headless Services, and the Services themselves
+func tlsDNSNames(redis *cachev1alpha1.Redis) []string {
+	names := []string{}
+	for _, service := range []string{redis.Name, headlessServiceName(redis), sentinelName(redis)} {
+		names = append(names, service, fmt.Sprintf("%s.%s.svc", service, redis.Namespace))
+	}
+	return append(names,
+		fmt.Sprintf("*.%s.%s.svc", headlessServiceName(redis), redis.Namespace),
+		fmt.Sprintf("*.%s.%s.svc", sentinelName(redis), redis.Namespace))
+}
+
+// certificateForRedis returns the cert-manager Certificate issuing the TLS Secret
+func (r *RedisReconciler) certificateForRedis(redis *cachev1alpha1.Redis) (*unstructured.Unstructured, error) {
+	issuer := redis.Spec.TLS.IssuerRef
+	kind := issuer.Kind
+	if kind == "" {
+		kind = "Issuer"
+	}
+	group := issuer.Group
+	if group == "" {
+		group = certificateGVK.Group
+	}
+	dnsNames := []interface{}{}
+	for _, name := range tlsDNSNames(redis) {
+		dnsNames = append(dnsNames, name)
+	}
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	certificate.SetName(tlsSecretName(redis))
+	certificate.SetNamespace(redis.Namespace)
+	certificate.SetLabels(labelsForRedis(redis))
+	certificate.Object["spec"] = map[string]interface{}{
+		"secretName": tlsSecretName(redis),
+		"commonName": fmt.Sprintf("%s.%s.svc", redis.Name, redis.Namespace),
+		"dnsNames":   dnsNames,
+		"usages":     []interface{}{"server auth", "client auth"},
+		"issuerRef": map[string]interface{}{
+			"name":  issuer.Name,
+			"kind":  kind,
+			"group": group,
+		},
+	}
+	if err := controllerutil.SetControllerReference(redis, certificate, r.Scheme); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// tlsError reports why the TLS Secret cannot be used yet. Its reason is surfaced in the
+// TLSReady condition.
+type tlsError struct {
+	reason  string
+	message string
+}
+
+func (e *tlsError) Error() string {
+	return e.message
+}
+
+// reconcileTLS requests the certificate from cert-manager when spec.tls.issuerRef is set and
+// checks that the TLS Secret holds a certificate, its key and the CA certificate before the
+// pods mount it. A Secret that is missing or incomplete is reported as a tlsError.
+func (r *RedisReconciler) reconcileTLS(ctx context.Context, redis *cachev1alpha1.Redis) error {
+	logger := log.FromContext(ctx)
+	if !tlsEnabled(redis) {
+		meta.RemoveStatusCondition(&redis.Status.Conditions, typeTLSReadyRedis)
+		redis.Status.TLS = nil
+		return nil
+	}
+
+	spec := redis.Spec.TLS
+	if (spec.SecretName == "") == (spec.IssuerRef == nil) {
+		return &tlsError{reason: "InvalidTLS", message: "exactly one of tls.secretName and tls.issuerRef must be set"}
+	}
+
+	if spec.IssuerRef != nil {
+		desired, err := r.certificateForRedis(redis)
+		if err != nil {
+			return err
+		}
+		found := &unstructured.Unstructured{}
+		found.SetGroupVersionKind(certificateGVK)
+		err = r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, found)
+		switch {
+		case meta.IsNoMatchError(err):
+			return &tlsError{reason: "CertManagerNotInstalled", message: "cert-manager is not installed, the Certificate cannot be requested"}
+		case err != nil && errors.IsNotFound(err):
+			logger.Info("Creating a new Certificate", "Certificate.Namespace", desired.GetNamespace(), "Certificate.Name", desired.GetName())
+			if err := r.Create(ctx, desired); err != nil {
+				logger.Error(err, "Failed to create new Certificate", "Certificate.Namespace", desired.GetNamespace(), "Certificate.Name", desired.GetName())
+				return err
+			}
+		case err != nil:
+			logger.Error(err, "Failed to get Certificate")
+			return err
+		case !equality.Semantic.DeepEqual(found.Object["spec"], desired.Object["spec"]):
+			found.Object["spec"] = desired.Object["spec"]
+			if err := r.Update(ctx, found); err != nil {
+				logger.Error(err, "Failed to update Certificate", "Certificate.Namespace", found.GetNamespace(), "Certificate.Name", found.GetName())
+				return err
+			}
+			logger.Info("Updated Certificate", "Certificate.Namespace", found.GetNamespace(), "Certificate.Name", found.GetName())
+		}
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: tlsSecretName(redis), Namespace: redis.Namespace}, secret)
+	if err != nil && errors.IsNotFound(err) {
+		if spec.IssuerRef != nil {
+			return &tlsError{reason: "CertificateNotReady", message: fmt.Sprintf("Waiting for cert-manager to issue Secret %s", tlsSecretName(redis))}
+		}
+		return &tlsError{reason: "SecretNotFound", message: fmt.Sprintf("Secret %s not found", tlsSecretName(redis))}
+	} else if err != nil {
+		return err
+	}
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, corev1.ServiceAccountRootCAKey} {
+		if len(secret.Data[key]) == 0 {
+			return &tlsError{reason: "InvalidSecret", message: fmt.Sprintf("Secret %s has no %s key", secret.Name, key)}
+		}
+	}
+
+	redis.Status.TLS = &cachev1alpha1.RedisTLSStatus{SecretName: secret.Name, CertificateHash: tlsSecretHash(secret)}
+	meta.SetStatusCondition(&redis.Status.Conditions, metav1.Condition{
+		Type:               typeTLSReadyRedis,
+		Status:             metav1.ConditionTrue,
+		Reason:             "SecretFound",
+		Message:            fmt.Sprintf("TLS certificate is read from Secret %s", secret.Name),
+		ObservedGeneration: redis.Generation,
+	})
+	return nil
+}
+
+// tlsSecretHash returns the hash of the certificate, its key and the CA certificate of the TLS Secret
+func tlsSecretHash(secret *corev1.Secret) string {
+	hash := sha256.New()
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, corev1.ServiceAccountRootCAKey} {
+		hash.Write(secret.Data[key])
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// tlsPodAnnotations returns the pod template annotations restarting the pods once the
+// certificate changes. It returns nil without TLS.
+func tlsPodAnnotations(redis *cachev1alpha1.Redis) map[string]string {
+	if !tlsEnabled(redis) || redis.Status.TLS == nil {
+		return nil
+	}
+	return map[string]string{tlsHashAnnotation: redis.Status.TLS.CertificateHash}
+}
+
+// tlsConfigForRedis returns the TLS configuration the operator connects to the Redis and
+// Sentinel servers with, trusting the CA certificate of the TLS Secret. It returns nil
+// without TLS.
+func tlsConfigForRedis(ctx context.Context, c client.Reader, redis *cachev1alpha1.Redis) (*tls.Config, error) {
+	if !tlsEnabled(redis) {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: tlsSecretName(redis), Namespace: redis.Namespace}, secret); err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(secret.Data[corev1.ServiceAccountRootCAKey]) {
+		return nil, fmt.Errorf("secret %s holds no valid CA certificate", secret.Name)
+	}
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
+
+// tlsConfigForPod returns the TLS configuration verifying the certificate of the given pod
+// against its stable DNS name, since the operator connects to the pod IP
+func tlsConfigForPod(tlsConfig *tls.Config, pod *corev1.Pod) *tls.Config {
+	if tlsConfig == nil {
+		return nil
+	}
+	podConfig := tlsConfig.Clone()
+	podConfig.ServerName = fmt.Sprintf("%s.%s.%s.svc", pod.Spec.Hostname, pod.Spec.Subdomain, pod.Namespace)
+	return podConfig
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TestTLSDirectives tests that TLS is served with the mounted certificate and used for replication and the cluster bus
+func TestTLSDirectives(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.TLS = &cachev1alpha1.RedisTLS{SecretName: "redis-tls"}
+	cluster := newTestRedis()
+	cluster.Spec.TLS = &cachev1alpha1.RedisTLS{SecretName: "redis-tls"}
+	cluster.Spec.Mode = cachev1alpha1.RedisModeCluster
+
+	// Act
+	directives := tlsDirectives(redis)
+	clusterDirectives := tlsDirectives(cluster)
+
+	// Assert
+	assert.Equal(t, "6380", directives["tls-port"], "TLS should be served on its own port")
+	assert.Equal(t, "/etc/redis-tls/tls.crt", directives["tls-cert-file"], "Certificate should be read from the mounted Secret")
+	assert.Equal(t, "/etc/redis-tls/ca.crt", directives["tls-ca-cert-file"], "CA certificate should be read from the mounted Secret")
+	assert.Equal(t, "yes", directives["tls-replication"], "Replication should use TLS")
+	assert.NotContains(t, directives, "tls-cluster", "Cluster bus directive should only be set in cluster mode")
+	assert.Equal(t, "yes", clusterDirectives["tls-cluster"], "Cluster bus should use TLS")
+	assert.Empty(t, tlsDirectives(newTestRedis()), "No TLS directives should be set without TLS")
+	assert.Equal(t, "6380", redisConfig(redis)["tls-port"], "TLS directives should be merged into redis.conf")
+}
+
+// TestPortsForRedisTLS tests that the TLS port is exposed and the plaintext port can be disabled
+func TestPortsForRedisTLS(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.TLS = &cachev1alpha1.RedisTLS{SecretName: "redis-tls"}
+	tlsOnly := newTestRedis()
+	tlsOnly.Spec.TLS = &cachev1alpha1.RedisTLS{SecretName: "redis-tls", DisablePlaintext: true}
+
+	// Act
+	ports := portsForRedis(redis)
+	tlsOnlyPorts := portsForRedis(tlsOnly)
+	servicePorts := servicePortsForRedis(tlsOnly, redisPort)
+
+	// Assert
+	assert.Len(t, ports, 2, "Plaintext and TLS ports should be exposed")
+	assert.Equal(t, int32(6380), ports[1].ContainerPort, "TLS port should be exposed")
+	assert.Len(t, tlsOnlyPorts, 1, "Plaintext port should be closed")
+	assert.Equal(t, "redis-tls", tlsOnlyPorts[0].Name, "Only the TLS port should be exposed")
+	assert.Len(t, servicePorts, 1, "Service should only route to the TLS port")
+	assert.Equal(t, int32(6380), servicePorts[0].Port, "Service should route to the TLS port")
+	assert.Equal(t, 0, redisListenPort(tlsOnly), "Redis should not listen on the plaintext port")
+}
+
+// TestRedisStartupScriptTLS tests that replicas and Sentinel lookups connect over TLS
+func TestRedisStartupScriptTLS(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.TLS = &cachev1alpha1.RedisTLS{SecretName: "redis-tls", DisablePlaintext: true}
+	redis.Spec.Sentinel = &cachev1alpha1.RedisSentinel{Replicas: 3, Quorum: 2}
+
+	// Act
+	script := redisStartupScript(redis)
+	sentinelScript := sentinelStartupScript(redis)
+
+	// Assert
+	assert.Contains(t, script, `--replicaof ${PRIMARY} 6380`, "Replicas should replicate over TLS")
+	assert.Contains(t, script, "--port 0", "Plaintext port should be closed")
+	assert.Contains(t, script, "redis-cli --tls --cacert /etc/redis-tls/ca.crt -h test-redis-sentinel -p 26380", "Sentinel should be asked over TLS")
+	assert.Contains(t, sentinelScript, "tls-port 26380\n", "Sentinel should serve TLS")
+	assert.Contains(t, sentinelScript, "port 0\n", "Sentinel plaintext port should be closed")
+	assert.Contains(t, sentinelScript, "6380 2", "Sentinel should monitor the primary over TLS")
+}
+
+// TestReconcileTLSSecretNotFound tests that a missing or incomplete TLS Secret is reported
+func TestReconcileTLSSecretNotFound(t *testing.T) {
+	// Arrange
+	missing := newTestRedis()
+	missing.Spec.TLS = &cachev1alpha1.RedisTLS{SecretName: "missing-tls"}
+	incomplete := newTestRedis()
+	incomplete.Spec.TLS = &cachev1alpha1.RedisTLS{SecretName: "redis-tls"}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis-tls", Namespace: "default"},
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")},
+	}
+	r := newFakeReconciler(t, secret)
+
+	// Act
+	missingErr := r.reconcileTLS(context.Background(), missing)
+	incompleteErr := r.reconcileTLS(context.Background(), incomplete)
+
+	// Assert
+	var tlsErr *tlsError
+	assert.ErrorAs(t, missingErr, &tlsErr, "Missing Secret should be reported as a tlsError")
+	assert.Equal(t, "SecretNotFound", tlsErr.reason, "Missing Secret should be reported")
+	assert.ErrorAs(t, incompleteErr, &tlsErr, "Incomplete Secret should be reported as a tlsError")
+	assert.Equal(t, "InvalidSecret", tlsErr.reason, "Secret without CA certificate should be rejected")
+}
+
+// TestReconcileTLSCertificate tests that a Certificate is requested from cert-manager and the issued Secret is used
+func TestReconcileTLSCertificate(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.TLS = &cachev1alpha1.RedisTLS{IssuerRef: &cachev1alpha1.RedisTLSIssuerRef{Name: "ca-issuer", Kind: "ClusterIssuer"}}
+	r := newFakeReconciler(t, redis)
+
+	// Act
+	pendingErr := r.reconcileTLS(context.Background(), redis)
+	assert.NoError(t, r.Create(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-redis-tls", Namespace: "default"},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:              []byte("cert"),
+			corev1.TLSPrivateKeyKey:        []byte("key"),
+			corev1.ServiceAccountRootCAKey: []byte("ca"),
+		},
+	}))
+	err := r.reconcileTLS(context.Background(), redis)
+
+	// Assert
+	var tlsErr *tlsError
+	assert.ErrorAs(t, pendingErr, &tlsErr, "Secret not yet issued should be reported as a tlsError")
+	assert.Equal(t, "CertificateNotReady", tlsErr.reason, "Certificate should be waited for")
+	assert.NoError(t, err, "reconcileTLS should not return an error once the Secret is issued")
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: "test-redis-tls", Namespace: "default"}, certificate))
+	issuer, _, _ := unstructured.NestedString(certificate.Object, "spec", "issuerRef", "kind")
+	assert.Equal(t, "ClusterIssuer", issuer, "Certificate should be requested from the referenced issuer")
+	dnsNames, _, _ := unstructured.NestedStringSlice(certificate.Object, "spec", "dnsNames")
+	assert.Contains(t, dnsNames, "*.test-redis-headless.default.svc", "Certificate should be valid for every pod")
+	assert.True(t, meta.IsStatusConditionTrue(redis.Status.Conditions, typeTLSReadyRedis), "TLSReady should be true")
+}
+
+// TestTLSPodAnnotations tests that a renewed certificate changes the pod templates so the pods are rolled
+func TestTLSPodAnnotations(t *testing.T) {
+	// Arrange
+	redis := newTestRedis()
+	redis.Spec.TLS = &cachev1alpha1.RedisTLS{SecretName: "redis-tls"}
+	redis.Spec.Sentinel = &cachev1alpha1.RedisSentinel{Replicas: 3, Quorum: 2}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis-tls", Namespace: "default"},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:              []byte("cert"),
+			corev1.TLSPrivateKeyKey:        []byte("key"),
+			corev1.ServiceAccountRootCAKey: []byte("ca"),
+		},
+	}
+	r := newFakeReconciler(t, secret)
+
+	// Act
+	assert.NoError(t, r.reconcileTLS(context.Background(), redis))
+	issued := podAnnotationsForRedis(redis)[tlsHashAnnotation]
+	sentinel, err := r.sentinelStatefulSetForRedis(redis, "redis-secret")
+	assert.NoError(t, err)
+	secret.Data[corev1.TLSCertKey] = []byte("renewed-cert")
+	assert.NoError(t, r.Update(context.Background(), secret))
+	assert.NoError(t, r.reconcileTLS(context.Background(), redis))
+	renewed := podAnnotationsForRedis(redis)[tlsHashAnnotation]
+
+	// Assert
+	assert.NotEmpty(t, issued, "Redis pod template should carry the certificate hash")
+	assert.Equal(t, "redis-tls", redis.Status.TLS.SecretName, "Status should record the served Secret")
+	assert.Equal(t, renewed, redis.Status.TLS.CertificateHash, "Status should record the served certificate")
+	assert.Equal(t, issued, sentinel.Spec.Template.Annotations[tlsHashAnnotation], "Sentinel pod template should carry the certificate hash")
+	assert.NotEqual(t, issued, renewed, "A renewed certificate should change the pod templates")
+	assert.NotContains(t, podAnnotationsForRedis(newTestRedis()), tlsHashAnnotation, "No certificate hash should be set without TLS")
+}
@@ -2,15 +2,53 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
 	cachev1alpha1 "github.com/salwazi/kubernetes-operator-redis/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// typeAvailableRedis represents the status of the StatefulSet reconciliation
+	typeAvailableRedis = "Available"
+	// typeCredentialsReadyRedis represents whether the Secret holding the password can be read
+	typeCredentialsReadyRedis = "CredentialsReady"
+	// typeAuthenticationEnforcedRedis represents whether the Redis servers reject unauthenticated clients
+	typeAuthenticationEnforcedRedis = "AuthenticationEnforced"
+	// typeConfigValidRedis represents whether spec.config only holds supported directives
+	typeConfigValidRedis = "ConfigValid"
+	// typeRestoredRedis represents whether the data volume was seeded from spec.restoreFrom
+	typeRestoredRedis = "Restored"
+	// typeStorageResizedRedis represents whether the data volumes have the size of spec.storage.size
+	typeStorageResizedRedis = "StorageResized"
+	// typeTLSReadyRedis represents whether the TLS Secret holds a certificate the pods can serve
+	typeTLSReadyRedis = "TLSReady"
+	// typeNetworkPolicyReadyRedis represents whether the NetworkPolicy of spec.networkPolicy is applied
+	typeNetworkPolicyReadyRedis = "NetworkPolicyReady"
+	// typeAppliedRedisUser represents whether the ACL user of a RedisUser is set up on every Redis server
+	typeAppliedRedisUser = "Applied"
+	// typeScheduleValidBackupSchedule represents whether the cron schedule of a RedisBackupSchedule can be parsed
+	typeScheduleValidBackupSchedule = "ScheduleValid"
+	// typeSkippedBackupSchedule represents whether the last activation of a RedisBackupSchedule
+	// was skipped because a previous backup was still in progress
+	typeSkippedBackupSchedule = "Skipped"
+)
+
+// labelsForRedis returns the labels selecting the resources that belong to the given Redis instance
+func labelsForRedis(redis *cachev1alpha1.Redis) map[string]string {
+	return map[string]string{
+		"app": redis.Name,
+	}
+}
+
 // Helper functions to check and remove string from a slice of strings.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
@@ -65,43 +103,81 @@ func (r *RedisReconciler) reconcileFinalizer(ctx context.Context, redis *cachev1
 }
 
 // updateRedisStatus updates the status of the Redis CR
-func (r *RedisReconciler) updateRedisStatus(ctx context.Context, redis *cachev1alpha1.Redis, deployment *appsv1.Deployment) error {
-	redis.Status.ReadyReplicas = deployment.Status.ReadyReplicas
-	redis.Status.TotalReplicas = deployment.Status.Replicas
-	redis.Status.Conditions = deployment.Status.Conditions
+func (r *RedisReconciler) updateRedisStatus(ctx context.Context, redis *cachev1alpha1.Redis, statefulSet *appsv1.StatefulSet) error {
+	redis.Status.ReadyReplicas = statefulSet.Status.ReadyReplicas
+	redis.Status.TotalReplicas = statefulSet.Status.Replicas
+
+	condition := metav1.Condition{
+		Type:               typeAvailableRedis,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Reconciled",
+		Message:            "All Redis replicas are ready",
+		ObservedGeneration: redis.Generation,
+	}
+	if statefulSet.Status.ReadyReplicas < desiredReplicas(redis) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Progressing"
+		condition.Message = fmt.Sprintf("%d of %d Redis replicas are ready", statefulSet.Status.ReadyReplicas, desiredReplicas(redis))
+	}
+	meta.SetStatusCondition(&redis.Status.Conditions, condition)
 	return r.Status().Update(ctx, redis)
 }
 
-// Implement the deleteExternalResources function to clean up any external resources
+// Implement the deleteExternalResources function to clean up any external resources. Only
+// the objects the instance controls are deleted, so that same-named objects created by
+// someone else are left untouched.
 func (r *RedisReconciler) deleteDependantResources(ctx context.Context, redis *cachev1alpha1.Redis) error {
 
-	// Delete the Secret
-	secretName := redis.Name + "-secret"
-	if secretName != "" {
-		secret := &corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      secretName,
-				Namespace: redis.Namespace,
-			},
-		}
-		err := r.Delete(ctx, secret)
-		if err != nil && !errors.IsNotFound(err) {
+	// Delete the generated Secret, a Secret supplied by the user is left untouched
+	if err := r.deleteOwned(ctx, redis, &corev1.Secret{}, managedSecretName(redis)); err != nil {
+		return err
+	}
+
+	// Delete the StatefulSet, its volume claims are handled according to the retention policy
+	if err := r.deleteOwned(ctx, redis, &appsv1.StatefulSet{}, redis.Name); err != nil {
+		return err
+	}
+
+	// Delete or retain the data volume claims
+	if err := r.deleteOrRetainDataVolumeClaims(ctx, redis); err != nil {
+		return err
+	}
+
+	// Delete the ConfigMap holding the configuration
+	if err := r.deleteOwned(ctx, redis, &corev1.ConfigMap{}, configMapName(redis)); err != nil {
+		return err
+	}
+
+	// Delete the NetworkPolicy
+	if err := r.deleteOwned(ctx, redis, &networkingv1.NetworkPolicy{}, redis.Name); err != nil {
+		return err
+	}
+
+	// Delete the client and headless Services
+	for _, serviceName := range []string{redis.Name, headlessServiceName(redis)} {
+		if err := r.deleteOwned(ctx, redis, &corev1.Service{}, serviceName); err != nil {
 			return err
 		}
 	}
 
-	// Delete the Deployment
-	deploymentName := redis.Name
-	deployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      deploymentName,
-			Namespace: redis.Namespace,
-		},
+	// Delete the Sentinel quorum
+	return r.deleteSentinel(ctx, redis)
+}
+
+// deleteOwned deletes the object of the given name in the namespace of the Redis instance
+// when the instance controls it. The object is read into obj, whose type selects the kind.
+func (r *RedisReconciler) deleteOwned(ctx context.Context, redis *cachev1alpha1.Redis, obj client.Object, name string) error {
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: redis.Namespace}, obj)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(obj, redis) {
+		return nil
 	}
-	err := r.Delete(ctx, deployment)
-	if err != nil && !errors.IsNotFound(err) {
+	if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
 		return err
 	}
-
 	return nil
 }